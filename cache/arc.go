@@ -0,0 +1,314 @@
+package cache
+
+import (
+	"io"
+)
+
+// ARC is a fixed size Adaptive Replacement Cache.
+// ARC is an enhancement over the standard LRU cache in that it tracks both
+// frequency and recency of use. This avoids a burst in access to new
+// entries from evicting the frequently used older entries. It adds some
+// additional tracking overhead to a standard LRU cache, computationally
+// it is roughly 2x the cost, and the extra memory overhead is linear
+// with the size of the cache. Unlike TwoQueue, ARC adapts the split
+// between recent and frequent entries by itself.
+// ARC implementation is based on https://github.com/hashicorp/golang-lru/blob/master/arc.go
+type ARC[K comparable, V any] struct {
+	// size is the total capacity of the cache.
+	size int
+	// p is the dynamic preference towards t1 or t2.
+	p int
+
+	// t1 is the LRU for recently accessed items.
+	t1 *LRU[K, V]
+	// b1 is the LRU for evictions from t1.
+	b1 *LRU[K, struct{}]
+	// t2 is the LRU for frequently accessed items.
+	t2 *LRU[K, V]
+	// b2 is the LRU for evictions from t2.
+	b2 *LRU[K, struct{}]
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+}
+
+func newARC(size int) *ARC[uint64, interface{}] {
+	return newTypedARC[uint64, interface{}](size, nil)
+}
+
+func newTypedARC[K comparable, V any](size int, onEvict EvictCallback[K, V]) *ARC[K, V] {
+	stats := newStatsCounter()
+	return &ARC[K, V]{
+		size:    size,
+		t1:      newListLRU[K, V](size),
+		b1:      newListLRU[K, struct{}](size),
+		t2:      newListLRU[K, V](size),
+		b2:      newListLRU[K, struct{}](size),
+		onEvict: countEvictions(stats, onEvict),
+		stats:   stats,
+	}
+}
+
+// Put puts an item into cache.
+func (c *ARC[K, V]) Put(key K, value V) {
+	c.stats.put()
+
+	// Check if the value is contained in t1 (recent),
+	// then promote it to t2 (frequent)
+	if old, ok := c.t1.take(key); ok {
+		c.t2.Put(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
+		return
+	}
+
+	// Check if the value is already in t2 (frequent),
+	// then just update it
+	if old, ok := c.t2.Peek(key); ok {
+		c.t2.Put(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
+		return
+	}
+
+	// Check if this value was recently evicted from the
+	// recently used list, t1 is too small so increase p
+	if c.b1.contains(key) {
+		c.stats.ghostHit()
+		delta := 1
+		b1Len := c.b1.Len()
+		b2Len := c.b2.Len()
+		if b2Len > b1Len {
+			delta = b2Len / b1Len
+		}
+		if c.p+delta >= c.size {
+			c.p = c.size
+		} else {
+			c.p += delta
+		}
+
+		if c.t1.Len()+c.t2.Len() >= c.size {
+			c.replace(false)
+		}
+		c.b1.Remove(key)
+		c.t2.Put(key, value)
+		return
+	}
+
+	// Check if this value was recently evicted from the
+	// frequently used list, t2 is too small so decrease p
+	if c.b2.contains(key) {
+		c.stats.ghostHit()
+		delta := 1
+		b1Len := c.b1.Len()
+		b2Len := c.b2.Len()
+		if b1Len > b2Len {
+			delta = b1Len / b2Len
+		}
+		if delta >= c.p {
+			c.p = 0
+		} else {
+			c.p -= delta
+		}
+
+		if c.t1.Len()+c.t2.Len() >= c.size {
+			c.replace(true)
+		}
+		c.b2.Remove(key)
+		c.t2.Put(key, value)
+		return
+	}
+
+	if c.t1.Len()+c.t2.Len() >= c.size {
+		c.replace(false)
+	}
+
+	// Keep the size of the ghost lists trim
+	if c.b1.Len() > c.size-c.p {
+		c.b1.removeOldest()
+	}
+	if c.b2.Len() > c.p {
+		c.b2.removeOldest()
+	}
+
+	// Put it to recent list
+	c.t1.Put(key, value)
+}
+
+// replace adaptively evicts from either t1 or t2
+// based on the current learned value of p.
+// revive:disable-next-line:flag-parameter
+func (c *ARC[K, V]) replace(b2ContainsKey bool) {
+	t1Len := c.t1.Len()
+	if t1Len > 0 && (t1Len > c.p || (t1Len == c.p && b2ContainsKey)) {
+		if k, v, ok := c.t1.getAndRemoveOldest(); ok {
+			c.b1.Put(k, struct{}{})
+			c.onEvict.call(k, v, EvictCapacity)
+		}
+		return
+	}
+
+	if k, v, ok := c.t2.getAndRemoveOldest(); ok {
+		c.b2.Put(k, struct{}{})
+		c.onEvict.call(k, v, EvictCapacity)
+	}
+}
+
+// Get retrives an item from cache.
+func (c *ARC[K, V]) Get(key K) (V, bool) {
+	// If in recent list, move it to frequent list
+	if val, ok := c.t1.take(key); ok {
+		c.stats.hit()
+		c.t2.Put(key, val)
+		return val, ok
+	}
+
+	// Check in frequent list
+	val, ok := c.t2.Get(key)
+	c.stats.lookup(ok)
+	return val, ok
+}
+
+// Peek reads an item from cache. The action is no considered 'Use'.
+func (c *ARC[K, V]) Peek(key K) (V, bool) {
+	if val, ok := c.t1.Peek(key); ok {
+		return val, ok
+	}
+	return c.t2.Peek(key)
+}
+
+// Remove eliminates an item from cache.
+func (c *ARC[K, V]) Remove(key K) {
+	if val, ok := c.t1.take(key); ok {
+		c.onEvict.call(key, val, EvictRemoved)
+		return
+	}
+	if val, ok := c.t2.take(key); ok {
+		c.onEvict.call(key, val, EvictRemoved)
+		return
+	}
+	if c.b1.remove(key) {
+		return
+	}
+	if c.b2.remove(key) {
+		return
+	}
+}
+
+// Elems return all items in cache.
+func (c *ARC[K, V]) Elems() []*Item[K, V] {
+	size := c.Len()
+	elems := make([]*Item[K, V], 0, size)
+	elems = append(elems, c.t1.Elems()...)
+	elems = append(elems, c.t2.Elems()...)
+	return elems
+}
+
+// Range calls f for each item in cache until f returns false.
+func (c *ARC[K, V]) Range(f func(key K, value V) bool) {
+	if c.t1.rangeItems(f) {
+		c.t2.rangeItems(f)
+	}
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *ARC[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	return c.t1.removeIf(f, c.onEvict) + c.t2.removeIf(f, c.onEvict)
+}
+
+// Keys returns the keys of all items in cache.
+func (c *ARC[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	keys = c.t1.appendKeys(keys)
+	return c.t2.appendKeys(keys)
+}
+
+// Purge eliminates all items from cache, the ghost lists and
+// the learned target size are reset as well.
+func (c *ARC[K, V]) Purge() {
+	c.t1.removeIf(always[K, V], c.onEvict)
+	c.t2.removeIf(always[K, V], c.onEvict)
+	c.b1.removeIf(always[K, struct{}], nil)
+	c.b2.removeIf(always[K, struct{}], nil)
+	c.p = 0
+}
+
+// Len returns current cache size.
+func (c *ARC[K, V]) Len() int {
+	return c.t1.Len() + c.t2.Len()
+}
+
+// Cost returns the total cost of items in cache,
+// ARC does not support cost so each item costs 1.
+func (c *ARC[K, V]) Cost() int64 {
+	return c.t1.Cost() + c.t2.Cost()
+}
+
+// Cap returns the maximum number of items.
+func (c *ARC[K, V]) Cap() int {
+	return c.size
+}
+
+// Stats returns the counters of cache.
+func (c *ARC[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Snapshot writes all items in cache to w, the lists of ARC
+// and the learned target size are kept.
+func (c *ARC[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	return c.snapshot(codec.NewEncoder(w))
+}
+
+// Restore reads a snapshot from r into an empty cache.
+func (c *ARC[K, V]) Restore(r io.Reader, codec Codec) error {
+	return restoreSnapshot[K, V](c, codec.NewDecoder(r))
+}
+
+func (c *ARC[K, V]) snapshotKind() string {
+	return arcSnapshot
+}
+
+func (c *ARC[K, V]) snapshot(enc Encoder) error {
+	err := writeSnapshotHeader(enc, arcSnapshot, c.p, c.t1.Len(), c.t2.Len(), c.b1.Len(), c.b2.Len())
+	if err != nil {
+		return err
+	}
+	if err = c.t1.writeRecords(enc); err != nil {
+		return err
+	}
+	if err = c.t2.writeRecords(enc); err != nil {
+		return err
+	}
+	for _, ghost := range []*LRU[K, struct{}]{c.b1, c.b2} {
+		for ele := ghost.ll.Back(); ele != nil; ele = ele.Prev() {
+			kv := ele.Value.(*lruEntry[K, struct{}])
+			if err = enc.Encode(&snapshotRecord[K, V]{Key: kv.Key}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (c *ARC[K, V]) restoreRecord(_ *snapshotHeader, section int, rec *snapshotRecord[K, V]) {
+	switch section {
+	case 0:
+		c.t1.add(rec.Key, rec.Value)
+	case 1:
+		c.t2.add(rec.Key, rec.Value)
+	case 2:
+		c.b1.add(rec.Key, struct{}{})
+	case 3:
+		c.b2.add(rec.Key, struct{}{})
+	}
+}
+
+// finishRestore evicts items if the snapshot was taken from a larger cache.
+func (c *ARC[K, V]) finishRestore(h *snapshotHeader) {
+	c.p = h.P
+	if c.p > c.size {
+		c.p = c.size
+	}
+	for c.Len() > c.size {
+		c.replace(false)
+	}
+}
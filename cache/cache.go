@@ -13,22 +13,43 @@
 
 package cache
 
-import "sync"
+import (
+	"fmt"
+	"io"
+	"sync"
+)
 
 // Cache is an interface for cache system
-type Cache interface {
+type Cache[K comparable, V any] interface {
 	// Put puts an item into cache.
-	Put(key uint64, value interface{})
+	Put(key K, value V)
 	// Get retrives an item from cache.
-	Get(key uint64) (interface{}, bool)
+	Get(key K) (V, bool)
 	// Peek reads an item from cache. The action is no considered 'Use'.
-	Peek(key uint64) (interface{}, bool)
+	Peek(key K) (V, bool)
 	// Remove eliminates an item from cache.
-	Remove(key uint64)
+	Remove(key K)
 	// Elems return all items in cache.
-	Elems() []*Item
+	Elems() []*Item[K, V]
 	// Len returns current cache size
 	Len() int
+	// Cost returns the total cost of items in cache
+	Cost() int64
+	// Cap returns the maximum number of items, 0 means no limit
+	Cap() int
+	// Stats returns the counters of cache
+	Stats() Stats
+	// Range calls f for each item in cache until f returns false,
+	// f must not call back into the cache.
+	Range(f func(key K, value V) bool)
+	// RemoveIf eliminates the items for which f returns true and returns the count.
+	RemoveIf(f func(key K, value V) bool) int
+	// Keys returns the keys of all items in cache.
+	Keys() []K
+	// Purge eliminates all items from cache.
+	Purge()
+
+	Snapshotter
 }
 
 // Type is cache's type such as LRUCache and etc.
@@ -39,81 +60,274 @@ const (
 	LRUCache Type = 1
 	// TwoQueueCache is for 2Q cache
 	TwoQueueCache Type = 2
+	// ARCCache is for ARC cache
+	ARCCache Type = 3
+	// TinyLFUCache is for W-TinyLFU cache
+	TinyLFUCache Type = 4
 )
 
+func (t Type) String() string {
+	switch t {
+	case LRUCache:
+		return "LRUCache"
+	case TwoQueueCache:
+		return "TwoQueueCache"
+	case ARCCache:
+		return "ARCCache"
+	case TinyLFUCache:
+		return "TinyLFUCache"
+	default:
+		return fmt.Sprintf("Type(%d)", int(t))
+	}
+}
+
 var (
 	// DefaultCacheType set default cache type for NewDefaultCache function
 	DefaultCacheType = LRUCache
 )
 
-type threadSafeCache struct {
-	cache Cache
+// CostFunc returns the cost of a value, e.g. its size in bytes.
+type CostFunc[V any] func(value V) int64
+
+// EvictReason is the reason why an item left the cache.
+type EvictReason int
+
+const (
+	// EvictCapacity means the item was evicted to make room for others
+	EvictCapacity EvictReason = iota + 1
+	// EvictExpired means the item outlived its TTL
+	EvictExpired
+	// EvictRemoved means the item was removed explicitly
+	EvictRemoved
+	// EvictReplaced means the item value was overwritten by Put
+	EvictReplaced
+)
+
+func (r EvictReason) String() string {
+	switch r {
+	case EvictCapacity:
+		return "capacity"
+	case EvictExpired:
+		return "expired"
+	case EvictRemoved:
+		return "removed"
+	case EvictReplaced:
+		return "replaced"
+	default:
+		return "unknown"
+	}
+}
+
+// EvictCallback is called with the key, the old value and the reason
+// whenever an item leaves the cache. It is invoked synchronously while
+// the cache is locked, so it must not call back into the cache.
+type EvictCallback[K comparable, V any] func(key K, value V, reason EvictReason)
+
+func (f EvictCallback[K, V]) call(key K, value V, reason EvictReason) {
+	if f != nil {
+		f(key, value, reason)
+	}
+}
+
+// always is a RemoveIf predicate matching every item.
+func always[K comparable, V any](K, V) bool {
+	return true
+}
+
+type threadSafeCache[K comparable, V any] struct {
+	cache Cache[K, V]
 	lock  sync.RWMutex
 }
 
-func newThreadSafeCache(cache Cache) Cache {
-	return &threadSafeCache{
+func newThreadSafeCache[K comparable, V any](cache Cache[K, V]) Cache[K, V] {
+	return &threadSafeCache[K, V]{
 		cache: cache,
 	}
 }
 
 // Put puts an item into cache.
-func (c *threadSafeCache) Put(key uint64, value interface{}) {
+func (c *threadSafeCache[K, V]) Put(key K, value V) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	c.cache.Put(key, value)
 }
 
 // Get retrives an item from cache.
-// When Get method called, LRU and TwoQueue cache will rearrange entries
+// When Get method called, LRU, TwoQueue and ARC cache will rearrange entries
 // so we must use write lock.
-func (c *threadSafeCache) Get(key uint64) (interface{}, bool) {
+func (c *threadSafeCache[K, V]) Get(key K) (V, bool) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	return c.cache.Get(key)
 }
 
 // Peek reads an item from cache. The action is no considered 'Use'.
-func (c *threadSafeCache) Peek(key uint64) (interface{}, bool) {
+func (c *threadSafeCache[K, V]) Peek(key K) (V, bool) {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	return c.cache.Peek(key)
 }
 
 // Remove eliminates an item from cache.
-func (c *threadSafeCache) Remove(key uint64) {
+func (c *threadSafeCache[K, V]) Remove(key K) {
 	c.lock.Lock()
 	defer c.lock.Unlock()
 	c.cache.Remove(key)
 }
 
 // Elems return all items in cache.
-func (c *threadSafeCache) Elems() []*Item {
+func (c *threadSafeCache[K, V]) Elems() []*Item[K, V] {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	return c.cache.Elems()
 }
 
 // Len returns current cache size
-func (c *threadSafeCache) Len() int {
+func (c *threadSafeCache[K, V]) Len() int {
 	c.lock.RLock()
 	defer c.lock.RUnlock()
 	return c.cache.Len()
 }
 
-// NewCache create Cache instance by CacheType
-func NewCache(size int, cacheType Type) Cache {
+// Cost returns the total cost of items in cache
+func (c *threadSafeCache[K, V]) Cost() int64 {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cache.Cost()
+}
+
+// Cap returns the maximum number of items, 0 means no limit.
+// It never changes, so no lock is needed.
+func (c *threadSafeCache[K, V]) Cap() int {
+	return c.cache.Cap()
+}
+
+// Stats returns the counters of cache.
+// The counters are atomic, so no lock is needed.
+func (c *threadSafeCache[K, V]) Stats() Stats {
+	return c.cache.Stats()
+}
+
+// Range calls f for each item in cache until f returns false,
+// the read lock is held until Range returns.
+func (c *threadSafeCache[K, V]) Range(f func(key K, value V) bool) {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	c.cache.Range(f)
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *threadSafeCache[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.cache.RemoveIf(f)
+}
+
+// Keys returns the keys of all items in cache.
+func (c *threadSafeCache[K, V]) Keys() []K {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cache.Keys()
+}
+
+// Purge eliminates all items from cache.
+func (c *threadSafeCache[K, V]) Purge() {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	c.cache.Purge()
+}
+
+// Snapshot writes all items in cache to w.
+func (c *threadSafeCache[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	c.lock.RLock()
+	defer c.lock.RUnlock()
+	return c.cache.Snapshot(w, codec)
+}
+
+// Restore reads a snapshot from r into an empty cache.
+func (c *threadSafeCache[K, V]) Restore(r io.Reader, codec Codec) error {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	return c.cache.Restore(r, codec)
+}
+
+// raw returns the underlying cache which is not thread-safe.
+func (c *threadSafeCache[K, V]) raw() rawSnapshotter[K, V] {
+	return c.cache.(rawSnapshotter[K, V])
+}
+
+// New create Cache instance by CacheType, it panics on unknown cache type
+// or invalid size, see NewWithOptions.
+func New[K comparable, V any](size int, cacheType Type) Cache[K, V] {
+	return mustCache(NewWithOptions[K, V](size, cacheType))
+}
+
+// NewWithEvict create Cache instance by CacheType,
+// onEvict is called whenever an item leaves the cache.
+func NewWithEvict[K comparable, V any](size int, cacheType Type, onEvict EvictCallback[K, V]) Cache[K, V] {
+	return mustCache(NewWithOptions[K, V](size, cacheType, WithOnEvict(onEvict)))
+}
+
+// NewWithCost create Cache instance by CacheType which is bounded by the
+// total cost of items as well as by the number of items.
+// size or maxCost 0 means no limit. Only LRUCache and TwoQueueCache support cost.
+func NewWithCost[K comparable, V any](size int, maxCost int64, cacheType Type, cost CostFunc[V]) Cache[K, V] {
+	return mustCache(NewWithOptions[K, V](size, cacheType, WithCost(maxCost, cost)))
+}
+
+// mustCache panics with the error of NewWithOptions, it keeps the
+// constructors which do not return an error.
+func mustCache[K comparable, V any](c Cache[K, V], err error) Cache[K, V] {
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// cacheOptions holds the optional parameters of a cache.
+type cacheOptions[K comparable, V any] struct {
+	onEvict EvictCallback[K, V]
+	maxCost int64
+	cost    CostFunc[V]
+
+	// recentRatio and ghostRatio only apply to TwoQueueCache.
+	recentRatio float64
+	ghostRatio  float64
+}
+
+func newCacheOptions[K comparable, V any]() cacheOptions[K, V] {
+	return cacheOptions[K, V]{
+		recentRatio: defaultRecentRatio,
+		ghostRatio:  defaultGhostRatio,
+	}
+}
+
+// newRawCache create Cache instance by CacheType which is not thread-safe.
+// The cache type and options must have been validated by NewWithOptions.
+func newRawCache[K comparable, V any](size int, cacheType Type, opts cacheOptions[K, V]) Cache[K, V] {
 	switch cacheType {
 	case LRUCache:
-		return newThreadSafeCache(newLRU(size))
+		return newTypedLRU[K, V](size, opts.onEvict).withCost(opts.maxCost, opts.cost)
 	case TwoQueueCache:
-		return newThreadSafeCache(newTwoQueue(size))
+		return newTwoQueueParams[K, V](size, opts.recentRatio, opts.ghostRatio, opts.onEvict).withCost(opts.maxCost, opts.cost)
+	case ARCCache:
+		return newTypedARC[K, V](size, opts.onEvict)
 	default:
-		panic("Unknown cache type")
+		return newTypedTinyLFU[K, V](size, opts.onEvict)
 	}
 }
 
-// NewDefaultCache create Cache instance by default cache type
-func NewDefaultCache(size int) Cache {
-	return NewCache(size, DefaultCacheType)
+// NewDefault create Cache instance by default cache type
+func NewDefault[K comparable, V any](size int) Cache[K, V] {
+	return New[K, V](size, DefaultCacheType)
+}
+
+// NewCache create uint64 keyed Cache instance by CacheType
+func NewCache(size int, cacheType Type) Cache[uint64, interface{}] {
+	return New[uint64, interface{}](size, cacheType)
+}
+
+// NewDefaultCache create uint64 keyed Cache instance by default cache type
+func NewDefaultCache(size int) Cache[uint64, interface{}] {
+	return New[uint64, interface{}](size, DefaultCacheType)
 }
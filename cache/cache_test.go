@@ -14,7 +14,21 @@
 package cache
 
 import (
+	"bytes"
 	"context"
+	"errors"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/rand"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
 	"time"
 
@@ -176,10 +190,91 @@ func (s *testRegionCacheSuite) TestFifoCache(c *C) {
 	c.Assert(elems, HasLen, 1)
 	c.Assert(elems[0].Value, DeepEquals, "4")
 
-	cache.Remove()
-	cache.Remove()
-	cache.Remove()
+	val, ok := cache.Get(3)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, "3")
+	_, ok = cache.Get(1)
+	c.Assert(ok, IsFalse)
+
+	c.Assert(cache.Remove(), IsTrue)
+	c.Assert(cache.Remove(), IsTrue)
+	c.Assert(cache.Remove(), IsTrue)
 	c.Assert(cache.Len(), Equals, 0)
+	c.Assert(cache.Remove(), IsFalse)
+	_, ok = cache.Get(3)
+	c.Assert(ok, IsFalse)
+}
+
+func (s *testRegionCacheSuite) TestFifoDedup(c *C) {
+	var evicted []evictRecord
+	cache, err := NewFIFOWithOptions[uint64, interface{}](3, WithDedup(), WithOnEvict(func(key uint64, value interface{}, reason EvictReason) {
+		evicted = append(evicted, evictRecord{key, value, reason})
+	}))
+	c.Assert(err, IsNil)
+
+	cache.Put(1, "1")
+	cache.Put(2, "2")
+	elems := cache.Elems()
+	cache.Put(1, "1.1")
+	c.Assert(cache.Len(), Equals, 2)
+	val, _ := cache.Get(1)
+	c.Assert(val, Equals, "1.1")
+	// Items returned before are not modified.
+	c.Assert(elems[0].Value, Equals, "1")
+
+	// The position of a deduplicated key is kept.
+	cache.Put(3, "3")
+	cache.Put(4, "4")
+	c.Assert(evicted, DeepEquals, []evictRecord{
+		{1, "1", EvictReplaced},
+		{1, "1.1", EvictCapacity},
+	})
+
+	// Without dedup the newest item of a key is returned.
+	dup := NewFIFO(3)
+	dup.Put(1, "1")
+	dup.Put(1, "1.1")
+	val, _ = dup.Get(1)
+	c.Assert(val, Equals, "1.1")
+	dup.Remove()
+	val, _ = dup.Get(1)
+	c.Assert(val, Equals, "1.1")
+
+	_, err = NewFIFOWithOptions[uint64, interface{}](3, WithShards(2))
+	c.Assert(errors.Is(err, ErrInvalidOption), IsTrue)
+	_, err = NewFIFOWithOptions[uint64, interface{}](3, WithStaleGrace(time.Second))
+	c.Assert(err, ErrorMatches, ".*stale grace does not apply to FIFO")
+	_, err = NewFIFOWithOptions[uint64, interface{}](3, WithCost(10, CostFunc[interface{}](nil)))
+	c.Assert(err, ErrorMatches, ".*cost does not apply to FIFO")
+	_, err = NewWithOptions[uint64, interface{}](3, LRUCache, WithDedup())
+	c.Assert(errors.Is(err, ErrInvalidOption), IsTrue)
+}
+
+func (s *testRegionCacheSuite) TestFifoFromElems(c *C) {
+	// Sequence keys are searched, and the buffer is compacted on removal.
+	cache := NewFIFOCache[int, int](100)
+	for i := 0; i < 1000; i++ {
+		cache.Put(i, i)
+	}
+	c.Assert(cache.sorted, IsTrue)
+	c.Assert(cache.Len(), Equals, 100)
+	c.Assert(len(cache.entries) <= 200, IsTrue)
+	elems := cache.FromElems(949)
+	c.Assert(elems, HasLen, 50)
+	c.Assert(elems[0].Key, Equals, 950)
+	c.Assert(cache.FromElems(0), HasLen, 100)
+	c.Assert(cache.FromElems(999), HasLen, 0)
+
+	// Unordered keys are scanned.
+	cache.Put(0, 0)
+	c.Assert(cache.sorted, IsFalse)
+	elems = cache.FromElems(998)
+	c.Assert(elems, HasLen, 1)
+	c.Assert(elems[0].Key, Equals, 999)
+
+	for cache.Remove() {
+	}
+	c.Assert(cache.sorted, IsTrue)
 }
 
 func (s *testRegionCacheSuite) TestTwoQueueCache(c *C) {
@@ -256,3 +351,1501 @@ func (s *testRegionCacheSuite) TestTwoQueueCache(c *C) {
 	c.Assert(ok, IsFalse)
 	c.Assert(val, IsNil)
 }
+
+func (s *testRegionCacheSuite) TestARCCache(c *C) {
+	cache := newARC(3)
+	cache.Put(1, "1")
+	cache.Put(2, "2")
+	cache.Put(3, "3")
+
+	val, ok := cache.Get(3)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "3")
+
+	val, ok = cache.Get(2)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "2")
+
+	val, ok = cache.Get(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "1")
+
+	c.Assert(cache.Len(), Equals, 3)
+
+	cache.Put(4, "4")
+
+	c.Assert(cache.Len(), Equals, 3)
+
+	val, ok = cache.Get(3)
+	c.Assert(ok, IsFalse)
+	c.Assert(val, IsNil)
+
+	val, ok = cache.Get(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "1")
+
+	val, ok = cache.Get(2)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "2")
+
+	val, ok = cache.Get(4)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "4")
+
+	c.Assert(cache.Len(), Equals, 3)
+
+	val, ok = cache.Peek(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, "1")
+
+	elems := cache.Elems()
+	c.Assert(elems, HasLen, 3)
+	c.Assert(elems[0].Value, DeepEquals, "4")
+	c.Assert(elems[1].Value, DeepEquals, "2")
+	c.Assert(elems[2].Value, DeepEquals, "1")
+
+	cache.Remove(1)
+	cache.Remove(2)
+	cache.Remove(4)
+
+	c.Assert(cache.Len(), Equals, 0)
+
+	val, ok = cache.Get(1)
+	c.Assert(ok, IsFalse)
+	c.Assert(val, IsNil)
+
+	val, ok = cache.Get(2)
+	c.Assert(ok, IsFalse)
+	c.Assert(val, IsNil)
+
+	val, ok = cache.Get(3)
+	c.Assert(ok, IsFalse)
+	c.Assert(val, IsNil)
+
+	val, ok = cache.Get(4)
+	c.Assert(ok, IsFalse)
+	c.Assert(val, IsNil)
+
+	// A key evicted from the recent list is remembered in the ghost
+	// list and goes straight to the frequent list when it comes back.
+	cache.Put(1, "1")
+	cache.Put(2, "2")
+	cache.Put(3, "3")
+	cache.Put(4, "4")
+	c.Assert(cache.Len(), Equals, 3)
+	c.Assert(cache.b1.contains(1), IsTrue)
+
+	cache.Put(1, "1")
+	c.Assert(cache.t2.contains(1), IsTrue)
+	c.Assert(cache.p, Equals, 1)
+}
+
+func (s *testRegionCacheSuite) TestTypedCache(c *C) {
+	for _, cacheType := range []Type{LRUCache, TwoQueueCache, ARCCache} {
+		cache := New[string, int](2, cacheType)
+		cache.Put("a", 1)
+		cache.Put("b", 2)
+
+		val, ok := cache.Get("a")
+		c.Assert(ok, IsTrue)
+		c.Assert(val, Equals, 1)
+
+		cache.Put("c", 3)
+		c.Assert(cache.Len(), Equals, 2)
+
+		val, ok = cache.Get("b")
+		c.Assert(ok, IsFalse)
+		c.Assert(val, Equals, 0)
+
+		elems := cache.Elems()
+		c.Assert(elems, HasLen, 2)
+
+		cache.Remove("a")
+		_, ok = cache.Peek("a")
+		c.Assert(ok, IsFalse)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ttl := NewTTLCache[string, []byte](ctx, time.Second, time.Minute)
+	ttl.Put("k", []byte("v"))
+	val, ok := ttl.Get("k")
+	c.Assert(ok, IsTrue)
+	c.Assert(val, DeepEquals, []byte("v"))
+
+	fifo := NewFIFOCache[string, int](2)
+	fifo.Put("a", 1)
+	fifo.Put("b", 2)
+	fifo.Put("c", 3)
+	elems := fifo.FromElems("a")
+	c.Assert(elems, HasLen, 2)
+	c.Assert(elems[0].Key, Equals, "b")
+	c.Assert(elems[1].Value, Equals, 3)
+}
+
+func (s *testRegionCacheSuite) TestShardedCache(c *C) {
+	cache := NewSharded[uint64, int](64, LRUCache, 4)
+	for i := uint64(0); i < 32; i++ {
+		cache.Put(i, int(i))
+	}
+	c.Assert(cache.Len(), Equals, 32)
+	c.Assert(cache.Elems(), HasLen, 32)
+
+	for i := uint64(0); i < 32; i++ {
+		val, ok := cache.Get(i)
+		c.Assert(ok, IsTrue)
+		c.Assert(val, Equals, int(i))
+	}
+
+	cache.Remove(1)
+	_, ok := cache.Peek(1)
+	c.Assert(ok, IsFalse)
+	c.Assert(cache.Len(), Equals, 31)
+
+	// Capacity is bounded per shard, the total is size.
+	c.Assert(cache.Cap(), Equals, 64)
+	for i := uint64(100); i < 1000; i++ {
+		cache.Put(i, int(i))
+	}
+	c.Assert(cache.Len() <= 64, IsTrue)
+
+	// The remainder of size goes to the first shards.
+	uneven := NewSharded[uint64, int](10, LRUCache, 4).(*shardedCache[uint64, int])
+	c.Assert(uneven.Cap(), Equals, 10)
+	for i, want := range []int{3, 3, 2, 2} {
+		c.Assert(uneven.shards[i].Cap(), Equals, want)
+	}
+	// There are no more shards than items, a shard of size 0 is unbounded.
+	small := NewSharded[uint64, int](2, LRUCache, 4).(*shardedCache[uint64, int])
+	c.Assert(small.shards, HasLen, 2)
+	c.Assert(small.Cap(), Equals, 2)
+}
+
+func (s *testRegionCacheSuite) TestHashKey(c *C) {
+	type point struct {
+		X, Y float64
+		Tag  interface{}
+	}
+	seed := maphash.MakeSeed()
+	negZero := math.Copysign(0, -1)
+
+	// Equal keys hash the same, including -0 and 0.
+	c.Assert(hashKey(seed, point{X: 0, Y: 1, Tag: "a"}), Equals, hashKey(seed, point{X: negZero, Y: 1, Tag: "a"}))
+	c.Assert(hashKey(seed, [2]int32{1, 2}), Equals, hashKey(seed, [2]int32{1, 2}))
+	c.Assert(hashKey[interface{}](seed, 1), Equals, hashKey[interface{}](seed, 1))
+	c.Assert(hashKey(seed, point{X: 1}) != hashKey(seed, point{X: 2}), IsTrue)
+	c.Assert(hashKey[interface{}](seed, int32(1)) != hashKey[interface{}](seed, int64(1)), IsTrue)
+
+	cache := NewSharded[point, int](64, LRUCache, 4)
+	for i := 0; i < 32; i++ {
+		cache.Put(point{X: float64(i), Tag: i}, i)
+	}
+	for i := 0; i < 32; i++ {
+		val, ok := cache.Get(point{X: float64(i), Tag: i})
+		c.Assert(ok, IsTrue)
+		c.Assert(val, Equals, i)
+	}
+}
+
+func benchmarkParallelCache(b *testing.B, cache Cache[uint64, int]) {
+	const keys = 1 << 16
+	for i := uint64(0); i < keys; i++ {
+		cache.Put(i, int(i))
+	}
+
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		var i uint64
+		for pb.Next() {
+			key := (i * 2654435761) % keys
+			if i%10 == 0 {
+				cache.Put(key, int(i))
+			} else {
+				cache.Get(key)
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkThreadSafeLRUParallel(b *testing.B) {
+	benchmarkParallelCache(b, New[uint64, int](1<<15, LRUCache))
+}
+
+func BenchmarkShardedLRUParallel(b *testing.B) {
+	benchmarkParallelCache(b, NewSharded[uint64, int](1<<15, LRUCache, 32))
+}
+
+func BenchmarkThreadSafeTwoQueueParallel(b *testing.B) {
+	benchmarkParallelCache(b, New[uint64, int](1<<15, TwoQueueCache))
+}
+
+func BenchmarkShardedTwoQueueParallel(b *testing.B) {
+	benchmarkParallelCache(b, NewSharded[uint64, int](1<<15, TwoQueueCache, 32))
+}
+
+type evictRecord struct {
+	key    uint64
+	value  interface{}
+	reason EvictReason
+}
+
+func (s *testRegionCacheSuite) TestEvictCallback(c *C) {
+	var evicted []evictRecord
+	onEvict := func(key uint64, value interface{}, reason EvictReason) {
+		evicted = append(evicted, evictRecord{key, value, reason})
+	}
+
+	for _, cacheType := range []Type{LRUCache, TwoQueueCache, ARCCache} {
+		evicted = nil
+		cache := NewWithEvict[uint64, interface{}](2, cacheType, onEvict)
+		cache.Put(1, "1")
+		cache.Put(1, "1'")
+		cache.Put(2, "2")
+		cache.Put(3, "3")
+		cache.Remove(3)
+		// Removing an absent key is not an eviction.
+		cache.Remove(4)
+
+		c.Assert(evicted, HasLen, 3, Commentf("cache type %v", cacheType))
+		c.Assert(evicted[0], Equals, evictRecord{1, "1", EvictReplaced})
+		c.Assert(evicted[1].reason, Equals, EvictCapacity)
+		c.Assert(evicted[2], Equals, evictRecord{3, "3", EvictRemoved})
+	}
+
+	evicted = nil
+	fifo := NewFIFOCacheWithEvict[uint64, interface{}](1, onEvict)
+	fifo.Put(1, "1")
+	fifo.Put(2, "2")
+	fifo.Remove()
+	c.Assert(evicted, DeepEquals, []evictRecord{{1, "1", EvictCapacity}, {2, "2", EvictRemoved}})
+
+	evicted = nil
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ttl := NewTTLCacheWithEvict[uint64, interface{}](ctx, 10*time.Millisecond, time.Minute, onEvict)
+	ttl.PutWithTTL(1, "1", time.Millisecond)
+	ttl.Put(2, "2")
+	ttl.Put(2, "2'")
+	ttl.Remove(2)
+	time.Sleep(50 * time.Millisecond)
+	ttl.Lock()
+	c.Assert(evicted, DeepEquals, []evictRecord{{2, "2", EvictReplaced}, {2, "2'", EvictRemoved}, {1, "1", EvictExpired}})
+	ttl.Unlock()
+}
+
+func (s *testRegionCacheSuite) TestStats(c *C) {
+	for _, cacheType := range []Type{LRUCache, TwoQueueCache, ARCCache} {
+		cache := NewSharded[uint64, int](2, cacheType, 1)
+		cache.Put(1, 1)
+		cache.Put(2, 2)
+		cache.Get(1)
+		cache.Get(3)
+		cache.Peek(2)
+		cache.Put(3, 3)
+		cache.Put(3, 4)
+		cache.Remove(3)
+
+		stats := cache.Stats()
+		c.Assert(stats.Hits, Equals, uint64(1))
+		c.Assert(stats.Misses, Equals, uint64(1))
+		c.Assert(stats.Puts, Equals, uint64(4))
+		c.Assert(stats.Evictions, Equals, EvictionStats{Capacity: 1, Removed: 1, Replaced: 1})
+		c.Assert(stats.Evictions.Total(), Equals, uint64(3))
+		c.Assert(stats.HitRatio(), Equals, 0.5)
+	}
+
+	// A key evicted from the recent list comes back through the ghost list.
+	cache := newTwoQueue(2)
+	cache.Put(1, 1)
+	cache.Put(2, 2)
+	cache.Put(3, 3)
+	cache.Put(1, 1)
+	c.Assert(cache.Stats().GhostHits, Equals, uint64(1))
+
+	sharded := NewSharded[uint64, int](8, LRUCache, 4)
+	for i := uint64(0); i < 8; i++ {
+		sharded.Put(i, int(i))
+		sharded.Get(i)
+	}
+	c.Assert(sharded.Stats().Puts, Equals, uint64(8))
+	c.Assert(sharded.Stats().Hits+sharded.Stats().Misses, Equals, uint64(8))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ttl := NewTTL(ctx, time.Minute, time.Minute)
+	ttl.Put(1, 1)
+	ttl.PutWithTTL(2, 2, -time.Second)
+	ttl.Get(1)
+	ttl.Get(2)
+	c.Assert(ttl.Stats(), Equals, Stats{Hits: 1, Misses: 1, Puts: 2})
+}
+
+func (s *testRegionCacheSuite) TestLoadingCache(c *C) {
+	var (
+		loads   int32
+		release = make(chan struct{})
+	)
+	loader := func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		if key == "bad" {
+			return 0, errors.New("not found")
+		}
+		return len(key), nil
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewLoadingCache[string, int](NewTTLCache[string, int](ctx, time.Minute, time.Minute), loader)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			val, err := cache.Get(ctx, "hello")
+			c.Check(err, IsNil)
+			c.Check(val, Equals, 5)
+		}()
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+	wg.Wait()
+	c.Assert(atomic.LoadInt32(&loads), Equals, int32(1))
+
+	// Hits are served from cache.
+	val, err := cache.Get(ctx, "hello")
+	c.Assert(err, IsNil)
+	c.Assert(val, Equals, 5)
+	c.Assert(atomic.LoadInt32(&loads), Equals, int32(1))
+
+	// Errors are not cached.
+	_, err = cache.Get(ctx, "bad")
+	c.Assert(err, ErrorMatches, "not found")
+	_, err = cache.Get(ctx, "bad")
+	c.Assert(err, ErrorMatches, "not found")
+	c.Assert(atomic.LoadInt32(&loads), Equals, int32(3))
+
+	lru := NewLoadingCache[string, int](New[string, int](10, LRUCache), func(ctx context.Context, key string) (int, error) {
+		panic("boom")
+	})
+	c.Assert(func() { lru.Get(ctx, "x") }, PanicMatches, "boom")
+}
+
+// waitFor waits until cond is true.
+func waitFor(c *C, cond func() bool) {
+	for i := 0; i < 200 && !cond(); i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	c.Assert(cond(), IsTrue)
+}
+
+// staleReader is a cache whose Get misses, like a Get which raced
+// with a load.
+type staleReader[K comparable, V any] struct {
+	Cache[K, V]
+}
+
+func (staleReader[K, V]) Get(K) (V, bool) {
+	var zero V
+	return zero, false
+}
+
+func (s *testRegionCacheSuite) TestLoadingCacheCancel(c *C) {
+	var (
+		loads   int32
+		release = make(chan struct{})
+		loadErr = make(chan error, 1)
+	)
+	type ctxKey struct{}
+	cache := NewLoadingCache[string, int](New[string, int](10, LRUCache), func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		<-release
+		if key == "hello" {
+			c.Check(ctx.Value(ctxKey{}), Equals, "v")
+		}
+		loadErr <- ctx.Err()
+		return len(key), nil
+	})
+
+	// The caller which started the load gives up, the others still get
+	// the value as the loader is not canceled with it.
+	ctx, cancel := context.WithCancel(context.WithValue(context.Background(), ctxKey{}, "v"))
+	first := make(chan error, 1)
+	go func() {
+		_, err := cache.Get(ctx, "hello")
+		first <- err
+	}()
+	waitFor(c, func() bool { return atomic.LoadInt32(&loads) == 1 })
+	second := make(chan int, 1)
+	go func() {
+		val, err := cache.Get(context.Background(), "hello")
+		c.Check(err, IsNil)
+		second <- val
+	}()
+	cancel()
+	c.Assert(<-first, Equals, context.Canceled)
+	close(release)
+	c.Assert(<-second, Equals, 5)
+	c.Assert(<-loadErr, IsNil)
+	c.Assert(atomic.LoadInt32(&loads), Equals, int32(1))
+
+	// A waiter gives up on its own ctx only.
+	release = make(chan struct{})
+	waitCtx, waitCancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer waitCancel()
+	_, err := cache.Get(waitCtx, "world")
+	c.Assert(err, Equals, context.DeadlineExceeded)
+	close(release)
+	c.Assert(<-loadErr, IsNil)
+
+	// A caller which misses after a load completed does not load again.
+	loads = 0
+	stale := NewLoadingCache[string, int](staleReader[string, int]{New[string, int](10, LRUCache)}, func(ctx context.Context, key string) (int, error) {
+		atomic.AddInt32(&loads, 1)
+		return len(key), nil
+	})
+	for i := 0; i < 2; i++ {
+		val, err := stale.Get(context.Background(), "hello")
+		c.Assert(err, IsNil)
+		c.Assert(val, Equals, 5)
+	}
+	c.Assert(atomic.LoadInt32(&loads), Equals, int32(1))
+}
+
+func (s *testRegionCacheSuite) TestLoadingCacheSuperseded(c *C) {
+	started := make(chan struct{}, 1)
+	release := make(chan struct{})
+	cache := NewLoadingCache[string, int](New[string, int](10, LRUCache), func(ctx context.Context, key string) (int, error) {
+		started <- struct{}{}
+		<-release
+		return len(key), nil
+	})
+
+	// A Put while loading is not overwritten by the loaded value,
+	// the waiters still get the loaded value.
+	loaded := make(chan int, 1)
+	go func() {
+		val, err := cache.Get(context.Background(), "hello")
+		c.Check(err, IsNil)
+		loaded <- val
+	}()
+	<-started
+	cache.Put("hello", 1)
+	release <- struct{}{}
+	c.Assert(<-loaded, Equals, 5)
+	val, err := cache.Get(context.Background(), "hello")
+	c.Assert(err, IsNil)
+	c.Assert(val, Equals, 1)
+
+	// A Remove while loading is not undone by the loaded value.
+	go func() {
+		val, err := cache.Get(context.Background(), "world")
+		c.Check(err, IsNil)
+		loaded <- val
+	}()
+	<-started
+	cache.Remove("world")
+	release <- struct{}{}
+	c.Assert(<-loaded, Equals, 5)
+	_, ok := cache.cache.Peek("world")
+	c.Assert(ok, IsFalse)
+
+	// A later load is put into cache.
+	close(release)
+	val, err = cache.Get(context.Background(), "world")
+	c.Assert(err, IsNil)
+	c.Assert(val, Equals, 5)
+	_, ok = cache.cache.Peek("world")
+	c.Assert(ok, IsTrue)
+}
+
+func (s *testRegionCacheSuite) TestCostCache(c *C) {
+	cost := func(value string) int64 { return int64(len(value)) }
+
+	for _, cacheType := range []Type{LRUCache, TwoQueueCache} {
+		cache := NewWithCost[int, string](0, 10, cacheType, cost)
+		cache.Put(1, "aaaa")
+		cache.Put(2, "bbbb")
+		c.Assert(cache.Len(), Equals, 2)
+		c.Assert(cache.Cost(), Equals, int64(8))
+
+		// Use 2 so that it is the last one to go.
+		cache.Get(2)
+		cache.Put(3, "cccccc")
+		c.Assert(cache.Cost() <= 10, IsTrue)
+		_, ok := cache.Peek(3)
+		c.Assert(ok, IsTrue)
+		_, ok = cache.Peek(1)
+		c.Assert(ok, IsFalse)
+
+		// Growing a value evicts others.
+		cache.Put(3, "cccccccc")
+		c.Assert(cache.Cost() <= 10, IsTrue)
+		val, ok := cache.Peek(3)
+		c.Assert(ok, IsTrue)
+		c.Assert(val, Equals, "cccccccc")
+
+		// An item larger than the budget is never admitted.
+		cache.Put(4, "dddddddddddd")
+		_, ok = cache.Peek(4)
+		c.Assert(ok, IsFalse)
+		_, ok = cache.Peek(3)
+		c.Assert(ok, IsTrue)
+
+		cache.Remove(3)
+		c.Assert(cache.Cost(), Equals, int64(0))
+		c.Assert(cache.Len(), Equals, 0)
+	}
+
+	// Without cost function every item costs 1.
+	lru := New[int, string](3, LRUCache)
+	lru.Put(1, "a")
+	lru.Put(2, "bb")
+	c.Assert(lru.Cost(), Equals, int64(2))
+
+	sharded := NewSharded[int, string](0, LRUCache, 2)
+	sharded.Put(1, "a")
+	c.Assert(sharded.Cost(), Equals, int64(1))
+}
+
+func (s *testRegionCacheSuite) TestExpirableLRU(c *C) {
+	var evicted []evictRecord
+	cache := NewExpirableLRUWithEvict[uint64, interface{}](2, time.Minute, func(key uint64, value interface{}, reason EvictReason) {
+		evicted = append(evicted, evictRecord{key, value, reason})
+	})
+
+	cache.PutWithTTL(1, "1", 20*time.Millisecond)
+	cache.Put(2, "2")
+	val, ok := cache.Get(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, "1")
+
+	// Bounded by size, 2 is the least recently used.
+	cache.Put(3, "3")
+	c.Assert(cache.Len(), Equals, 2)
+	_, ok = cache.Peek(2)
+	c.Assert(ok, IsFalse)
+
+	// Expired items are removed when read.
+	time.Sleep(30 * time.Millisecond)
+	c.Assert(cache.Elems(), HasLen, 1)
+	_, ok = cache.Peek(1)
+	c.Assert(ok, IsFalse)
+	c.Assert(cache.Len(), Equals, 1)
+
+	cache.PutWithTTL(4, "4", -time.Second)
+	cache.RemoveExpired()
+	c.Assert(cache.Len(), Equals, 1)
+
+	c.Assert(evicted, DeepEquals, []evictRecord{
+		{2, "2", EvictCapacity},
+		{1, "1", EvictExpired},
+		{4, "4", EvictExpired},
+	})
+	c.Assert(cache.Stats().Hits, Equals, uint64(1))
+}
+
+func (s *testRegionCacheSuite) TestTTLGC(c *C) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	cache := NewTTLCache[int, int](ctx, time.Hour, time.Hour)
+	for i := 0; i < 3*gcBatchSize; i++ {
+		cache.PutWithTTL(i, i, time.Duration(i)*time.Second)
+	}
+	// Refreshing an item moves it in the heap.
+	cache.PutWithTTL(0, 0, 3*time.Hour)
+	cache.Remove(1)
+
+	now := time.Now()
+	c.Assert(cache.gc(now.Add(-time.Second)), Equals, 0)
+	c.Assert(cache.gc(now.Add(time.Duration(2*gcBatchSize)*time.Second-time.Second/2)), Equals, 2*gcBatchSize-2)
+	c.Assert(cache.Len(), Equals, gcBatchSize+1)
+
+	_, ok := cache.Get(0)
+	c.Assert(ok, IsTrue)
+	c.Assert(cache.gc(now.Add(2*time.Hour)), Equals, gcBatchSize)
+	c.Assert(cache.Len(), Equals, 1)
+	c.Assert(cache.expires, HasLen, 1)
+
+	cache.Clear()
+	c.Assert(cache.Len(), Equals, 0)
+	c.Assert(cache.expires, HasLen, 0)
+}
+
+func newLargeTTL(b *testing.B, n int) *TTL[int, int] {
+	ctx, cancel := context.WithCancel(context.Background())
+	b.Cleanup(cancel)
+	cache := NewTTLCache[int, int](ctx, time.Hour, time.Hour)
+	for i := 0; i < n; i++ {
+		cache.Put(i, i)
+	}
+	return cache
+}
+
+func BenchmarkTTLPut1M(b *testing.B) {
+	cache := newLargeTTL(b, 1<<20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		cache.Put(i&(1<<20-1), i)
+	}
+}
+
+// BenchmarkTTLGC1M measures a GC pass over one million items
+// of which only a few have expired.
+func BenchmarkTTLGC1M(b *testing.B) {
+	cache := newLargeTTL(b, 1<<20)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		b.StopTimer()
+		for j := 0; j < 16; j++ {
+			cache.PutWithTTL(-j-1, j, -time.Second)
+		}
+		b.StartTimer()
+		cache.gc(time.Now())
+	}
+}
+
+func (s *testRegionCacheSuite) TestTTLCacheAPI(c *C) {
+	var cache Cache[string, int] = NewTTLCache[string, int](context.Background(), time.Hour, time.Hour)
+	ttl := cache.(*TTL[string, int])
+	defer ttl.Close()
+
+	ttl.PutWithTTL("a", 1, 50*time.Millisecond)
+	ttl.Put("b", 2)
+	ttl.PutWithTTL("c", 3, -time.Second)
+
+	// Expired items are hidden before GC removes them.
+	c.Assert(cache.Len(), Equals, 2)
+	c.Assert(cache.Elems(), HasLen, 2)
+	_, ok := cache.Peek("c")
+	c.Assert(ok, IsFalse)
+
+	val, expire, ok := ttl.GetWithExpiry("a")
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, 1)
+	c.Assert(time.Until(expire) <= 50*time.Millisecond, IsTrue)
+
+	// Touch slides the expiration by the item's own TTL.
+	time.Sleep(30 * time.Millisecond)
+	c.Assert(ttl.Touch("a"), IsTrue)
+	time.Sleep(30 * time.Millisecond)
+	_, ok = cache.Get("a")
+	c.Assert(ok, IsTrue)
+	c.Assert(ttl.Touch("c"), IsFalse)
+	c.Assert(ttl.Touch("d"), IsFalse)
+
+	ttl.Close()
+	ttl.Close()
+	select {
+	case <-ttl.done:
+	default:
+		c.Fatal("GC is not stopped")
+	}
+}
+
+func (s *testRegionCacheSuite) TestTTLStaleAndNegative(c *C) {
+	var evicted []string
+	onEvict := EvictCallback[string, int](func(key string, _ int, reason EvictReason) {
+		evicted = append(evicted, key+":"+reason.String())
+	})
+	ttl, err := NewTTLWithOptions[string, int](context.Background(), time.Hour, time.Minute,
+		WithStaleGrace(time.Minute), WithNegativeTTL(time.Second), WithOnEvict(onEvict))
+	c.Assert(err, IsNil)
+	defer ttl.Close()
+
+	ttl.Put("fresh", 1)
+	ttl.PutWithTTL("stale", 2, -time.Second)
+	ttl.PutWithTTL("gone", 3, -2*time.Minute)
+	ttl.PutNegative("absent")
+
+	res := ttl.Lookup("fresh")
+	c.Assert(res.State, Equals, LookupFresh)
+	c.Assert(res.Value, Equals, 1)
+	c.Assert(res.Negative, IsFalse)
+	res = ttl.Lookup("stale")
+	c.Assert(res.State, Equals, LookupStale)
+	c.Assert(res.Value, Equals, 2)
+	c.Assert(ttl.Lookup("gone").State, Equals, LookupMissing)
+	c.Assert(ttl.Lookup("none").State, Equals, LookupMissing)
+	res = ttl.Lookup("absent")
+	c.Assert(res.State, Equals, LookupFresh)
+	c.Assert(res.Negative, IsTrue)
+	c.Assert(time.Until(res.Expire) <= time.Second, IsTrue)
+
+	// Get is unchanged, stale and negative items are not found.
+	_, ok := ttl.Get("stale")
+	c.Assert(ok, IsFalse)
+	_, ok = ttl.Get("absent")
+	c.Assert(ok, IsFalse)
+	c.Assert(ttl.Keys(), DeepEquals, []string{"fresh"})
+	// Len counts the same items as Keys, negative entries are skipped.
+	c.Assert(ttl.Len(), Equals, 1)
+	c.Assert(ttl.Cost(), Equals, int64(1))
+	stats := ttl.Stats()
+	c.Assert(stats.Hits, Equals, uint64(2))
+	c.Assert(stats.Misses, Equals, uint64(5))
+
+	// GC keeps the items in the stale grace period.
+	c.Assert(ttl.gc(time.Now()), Equals, 1)
+	c.Assert(evicted, DeepEquals, []string{"gone:expired"})
+	c.Assert(ttl.Lookup("stale").State, Equals, LookupStale)
+	c.Assert(ttl.gc(time.Now().Add(2*time.Minute)), Equals, 3)
+	c.Assert(ttl.Lookup("stale").State, Equals, LookupMissing)
+
+	// A value replaces a negative entry.
+	ttl.PutNegative("key")
+	c.Assert(ttl.Len(), Equals, 0)
+	ttl.Put("key", 4)
+	res = ttl.Lookup("key")
+	c.Assert(res.State, Equals, LookupFresh)
+	c.Assert(res.Negative, IsFalse)
+	c.Assert(res.Value, Equals, 4)
+	c.Assert(ttl.Len(), Equals, 1)
+	ttl.PutNegative("key")
+	ttl.PutNegative("absent")
+	c.Assert(ttl.Len(), Equals, 0)
+	c.Assert(ttl.negatives, Equals, 2)
+	ttl.Remove("absent")
+	c.Assert(ttl.negatives, Equals, 1)
+
+	_, err = NewTTLWithOptions[string, int](context.Background(), time.Hour, time.Minute, WithDedup())
+	c.Assert(errors.Is(err, ErrInvalidOption), IsTrue)
+	_, err = NewTTLWithOptions[string, int](context.Background(), time.Hour, time.Minute, WithStaleGrace(-time.Second))
+	c.Assert(errors.Is(err, ErrInvalidOption), IsTrue)
+	_, err = NewWithOptions[string, int](10, LRUCache, WithNegativeTTL(time.Second))
+	c.Assert(errors.Is(err, ErrInvalidOption), IsTrue)
+	_, err = NewTTLWithOptions[string, int](context.Background(), time.Hour, time.Minute, WithShards(2))
+	c.Assert(err, ErrorMatches, ".*shards does not apply to TTL")
+}
+
+func (s *testRegionCacheSuite) TestTTLStaleGraceGC(c *C) {
+	// The options are applied before GC starts, GC with a short interval
+	// keeps the items in the stale grace period.
+	ttl, err := NewTTLWithOptions[string, int](context.Background(), time.Millisecond, time.Millisecond,
+		WithStaleGrace(time.Hour))
+	c.Assert(err, IsNil)
+	defer ttl.Close()
+
+	ttl.Put("key", 1)
+	time.Sleep(20 * time.Millisecond)
+	res := ttl.Lookup("key")
+	c.Assert(res.State, Equals, LookupStale)
+	c.Assert(res.Value, Equals, 1)
+}
+
+func (s *testRegionCacheSuite) TestSnapshot(c *C) {
+	for _, codec := range []Codec{GobCodec, JSONCodec} {
+		for _, cacheType := range []Type{LRUCache, TwoQueueCache, ARCCache, TinyLFUCache} {
+			cache := New[string, int](4, cacheType)
+			for i, k := range []string{"a", "b", "c", "d", "e"} {
+				cache.Put(k, i)
+			}
+			cache.Get("c")
+
+			var buf bytes.Buffer
+			c.Assert(cache.Snapshot(&buf, codec), IsNil)
+			restored := New[string, int](4, cacheType)
+			c.Assert(restored.Restore(bytes.NewReader(buf.Bytes()), codec), IsNil)
+			c.Assert(restored.Elems(), DeepEquals, cache.Elems())
+
+			// Ghost entries are kept as well.
+			cache.Put("a", 0)
+			restored.Put("a", 0)
+			c.Assert(restored.Elems(), DeepEquals, cache.Elems())
+
+			c.Assert(restored.Restore(bytes.NewReader(buf.Bytes()), codec), Equals, ErrRestoreNotEmpty)
+		}
+
+		// The remaining TTL is kept.
+		ttl := NewTTLCache[string, int](context.Background(), time.Minute, time.Hour)
+		ttl.Put("a", 1)
+		ttl.PutWithTTL("b", 2, time.Minute)
+		ttl.PutWithTTL("c", 3, -time.Second)
+		var buf bytes.Buffer
+		c.Assert(ttl.Snapshot(&buf, codec), IsNil)
+		ttl.Close()
+
+		restoredTTL := NewTTLCache[string, int](context.Background(), time.Minute, time.Hour)
+		c.Assert(restoredTTL.Restore(&buf, codec), IsNil)
+		c.Assert(restoredTTL.Len(), Equals, 2)
+		_, expire, ok := restoredTTL.GetWithExpiry("b")
+		c.Assert(ok, IsTrue)
+		c.Assert(time.Until(expire) <= time.Minute, IsTrue)
+		c.Assert(time.Until(expire) > 50*time.Second, IsTrue)
+		restoredTTL.Close()
+
+		// A snapshot can only be restored into a cache of the same kind.
+		buf.Reset()
+		lru := New[string, int](4, LRUCache)
+		lru.Put("a", 1)
+		c.Assert(lru.Snapshot(&buf, codec), IsNil)
+		c.Assert(New[string, int](4, ARCCache).Restore(&buf, codec), NotNil)
+
+		// Shards are routed by key, so the shard count may change.
+		sharded := NewSharded[int, int](256, LRUCache, 4)
+		for i := 0; i < 32; i++ {
+			sharded.Put(i, i)
+		}
+		buf.Reset()
+		c.Assert(sharded.Snapshot(&buf, codec), IsNil)
+		restoredSharded := NewSharded[int, int](256, LRUCache, 8)
+		c.Assert(restoredSharded.Restore(&buf, codec), IsNil)
+		c.Assert(restoredSharded.Len(), Equals, 32)
+		for i := 0; i < 32; i++ {
+			val, ok := restoredSharded.Peek(i)
+			c.Assert(ok, IsTrue)
+			c.Assert(val, Equals, i)
+		}
+		// The shards are unlocked after a failed restore.
+		c.Assert(restoredSharded.Restore(bytes.NewReader(nil), codec), Equals, ErrRestoreNotEmpty)
+		restoredSharded.Put(100, 100)
+		c.Assert(restoredSharded.Len(), Equals, 33)
+
+		// Each ARC shard keeps its own learned target size.
+		arc := NewSharded[int, int](64, ARCCache, 4).(*shardedCache[int, int])
+		for n := 0; n < 2; n++ {
+			for i := 0; i < 128; i++ {
+				arc.Put(i, i)
+			}
+		}
+		buf.Reset()
+		c.Assert(arc.Snapshot(&buf, codec), IsNil)
+		restoredARC := NewSharded[int, int](64, ARCCache, 4).(*shardedCache[int, int])
+		c.Assert(restoredARC.Restore(&buf, codec), IsNil)
+		learned := false
+		for i, s := range arc.shards {
+			p := s.raw().(*ARC[int, int]).p
+			learned = learned || p > 0
+			c.Assert(restoredARC.shards[i].raw().(*ARC[int, int]).p, Equals, p)
+		}
+		c.Assert(learned, IsTrue)
+	}
+}
+
+func (s *testRegionCacheSuite) TestTinyLFUCache(c *C) {
+	var evicted []evictRecord
+	cache := NewWithEvict[uint64, interface{}](100, TinyLFUCache, func(key uint64, value interface{}, reason EvictReason) {
+		evicted = append(evicted, evictRecord{key, value, reason})
+	})
+
+	// Fill the cache and make the first half popular.
+	for i := uint64(0); i < 100; i++ {
+		cache.Put(i, i)
+	}
+	c.Assert(cache.Len(), Equals, 100)
+	for n := 0; n < 3; n++ {
+		for i := uint64(0); i < 50; i++ {
+			_, ok := cache.Get(i)
+			c.Assert(ok, IsTrue)
+		}
+	}
+
+	// A scan of new keys does not flush the popular ones.
+	for i := uint64(1000); i < 2000; i++ {
+		cache.Put(i, i)
+	}
+	c.Assert(cache.Len(), Equals, 100)
+	for i := uint64(0); i < 50; i++ {
+		_, ok := cache.Peek(i)
+		c.Assert(ok, IsTrue)
+	}
+
+	cache.Put(1, "1")
+	val, ok := cache.Get(1)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, "1")
+	cache.Remove(1)
+	_, ok = cache.Get(1)
+	c.Assert(ok, IsFalse)
+	c.Assert(cache.Len(), Equals, 99)
+
+	stats := cache.Stats()
+	c.Assert(stats.Evictions.Capacity, Equals, uint64(1000))
+	c.Assert(stats.Evictions.Replaced, Equals, uint64(1))
+	c.Assert(stats.Evictions.Removed, Equals, uint64(1))
+	c.Assert(evicted, HasLen, 1002)
+
+	// Small caches still work.
+	small := New[int, int](1, TinyLFUCache)
+	small.Put(1, 1)
+	small.Put(2, 2)
+	c.Assert(small.Len(), Equals, 1)
+}
+
+// zipfTrace returns n keys drawn from a Zipf distribution over keys.
+func zipfTrace(r *rand.Rand, n int, keys uint64) []uint64 {
+	zipf := rand.NewZipf(r, 1.01, 1, keys-1)
+	trace := make([]uint64, n)
+	for i := range trace {
+		trace[i] = zipf.Uint64()
+	}
+	return trace
+}
+
+// scanTrace returns a Zipf trace over keys interleaved with scans of
+// scanLen keys which are never accessed again.
+func scanTrace(r *rand.Rand, n int, keys uint64, scanLen int) []uint64 {
+	trace := zipfTrace(r, n, keys)
+	next := keys
+	for i := 0; i+scanLen <= len(trace); i += 4 * scanLen {
+		for j := 0; j < scanLen; j++ {
+			trace[i+j] = next
+			next++
+		}
+	}
+	return trace
+}
+
+// hitRatio replays trace against a read-through cache, keys are put on a miss.
+func hitRatio(cache Cache[uint64, struct{}], trace []uint64) float64 {
+	for _, key := range trace {
+		if _, ok := cache.Get(key); !ok {
+			cache.Put(key, struct{}{})
+		}
+	}
+	return cache.Stats().HitRatio()
+}
+
+func (s *testRegionCacheSuite) TestHitRatio(c *C) {
+	const size = 1000
+	r := rand.New(rand.NewSource(1))
+	traces := []struct {
+		name  string
+		trace []uint64
+	}{
+		{"zipf", zipfTrace(r, 200000, 100000)},
+		{"scan", scanTrace(r, 200000, 100000, 2*size)},
+	}
+	types := []struct {
+		name      string
+		cacheType Type
+	}{
+		{"lru", LRUCache},
+		{"2q", TwoQueueCache},
+		{"arc", ARCCache},
+		{"tinylfu", TinyLFUCache},
+	}
+
+	for _, t := range traces {
+		ratios := make(map[Type]float64)
+		for _, typ := range types {
+			ratios[typ.cacheType] = hitRatio(New[uint64, struct{}](size, typ.cacheType), t.trace)
+			c.Logf("%-5s %-8s %.4f", t.name, typ.name, ratios[typ.cacheType])
+		}
+		c.Assert(ratios[TinyLFUCache] > ratios[LRUCache], IsTrue)
+		c.Assert(ratios[TinyLFUCache] > ratios[TwoQueueCache], IsTrue)
+	}
+}
+
+func (s *testRegionCacheSuite) TestCacheOptions(c *C) {
+	var evicted []evictRecord
+	cache, err := NewWithOptions[uint64, interface{}](4, TwoQueueCache,
+		WithRecentRatio(0.5),
+		WithGhostRatio(1),
+		WithOnEvict(func(key uint64, value interface{}, reason EvictReason) {
+			evicted = append(evicted, evictRecord{key, value, reason})
+		}),
+	)
+	c.Assert(err, IsNil)
+	tq := cache.(*threadSafeCache[uint64, interface{}]).cache.(*TwoQueue[uint64, interface{}])
+	c.Assert(tq.recentSize, Equals, 2)
+	c.Assert(tq.ghost.maxCount, Equals, 4)
+	for i := uint64(0); i < 5; i++ {
+		cache.Put(i, i)
+	}
+	c.Assert(evicted, DeepEquals, []evictRecord{{0, uint64(0), EvictCapacity}})
+
+	sharded, err := NewWithOptions[string, int](64, ARCCache, WithShards(4))
+	c.Assert(err, IsNil)
+	c.Assert(sharded.(*shardedCache[string, int]).shards, HasLen, 4)
+
+	_, err = NewWithOptions[uint64, interface{}](4, Type(100))
+	c.Assert(errors.Is(err, ErrUnknownCacheType), IsTrue)
+	c.Assert(func() { NewCache(4, Type(100)) }, PanicMatches, ".*unknown cache type.*")
+	c.Assert(NewCache(4, ARCCache).Cap(), Equals, 4)
+	// ARC has no unlimited mode, size 0 would evict on every Put.
+	c.Assert(func() { New[int, int](0, ARCCache) }, PanicMatches, ".*ARCCache requires a positive size")
+	// TinyLFU would hold one item in the window while Cap reports 0.
+	_, err = NewWithOptions[int, int](0, TinyLFUCache)
+	c.Assert(err, ErrorMatches, ".*TinyLFUCache requires a positive size")
+	c.Assert(New[int, int](1, TinyLFUCache).Cap(), Equals, 1)
+
+	costly, err := NewWithOptions[int, string](0, TwoQueueCache, WithCost(int64(4), func(value string) int64 { return int64(len(value)) }))
+	c.Assert(err, IsNil)
+	costly.Put(1, "ab")
+	costly.Put(2, "abc")
+	c.Assert(costly.Cost(), Equals, int64(3))
+	c.Assert(func() { NewWithCost[int, string](4, 10, ARCCache, nil) }, PanicMatches, ".*cost does not apply to ARCCache.*")
+	for _, tc := range []struct {
+		size      int
+		cacheType Type
+		opts      []Option
+	}{
+		{-1, LRUCache, nil},
+		{0, ARCCache, nil},
+		{4, TwoQueueCache, []Option{WithRecentRatio(0)}},
+		{4, TwoQueueCache, []Option{WithRecentRatio(1.5)}},
+		{4, TwoQueueCache, []Option{WithGhostRatio(-0.1)}},
+		{4, LRUCache, []Option{WithRecentRatio(0.5)}},
+		{4, LRUCache, []Option{WithShards(0)}},
+		{4, LRUCache, []Option{WithOnEvict(func(key string, value int, reason EvictReason) {})}},
+		{4, LRUCache, []Option{WithCost(-1, CostFunc[interface{}](nil))}},
+		{4, LRUCache, []Option{WithCost(10, func(value string) int64 { return 1 })}},
+		{4, TinyLFUCache, []Option{WithCost(10, CostFunc[interface{}](nil))}},
+		{4, ARCCache, []Option{WithDedup()}},
+		{4, LRUCache, []Option{WithStaleGrace(time.Second)}},
+	} {
+		_, err = NewWithOptions[uint64, interface{}](tc.size, tc.cacheType, tc.opts...)
+		c.Assert(errors.Is(err, ErrInvalidOption), IsTrue, Commentf("%+v", tc))
+	}
+}
+
+func (s *testRegionCacheSuite) TestRangeAndRemoveIf(c *C) {
+	caches := map[string]Cache[int, int]{
+		"lru":     New[int, int](100, LRUCache),
+		"2q":      New[int, int](100, TwoQueueCache),
+		"arc":     New[int, int](100, ARCCache),
+		"tinylfu": New[int, int](100, TinyLFUCache),
+		"sharded": NewSharded[int, int](100, LRUCache, 4),
+		"ttl":     NewTTLCache[int, int](context.Background(), time.Minute, time.Minute),
+		"expire":  NewExpirableLRU[int, int](100, time.Minute),
+	}
+	for name, cache := range caches {
+		comment := Commentf("%s", name)
+		var removed []int
+		for i := 0; i < 10; i++ {
+			cache.Put(i, i*10)
+			cache.Get(i)
+		}
+
+		sum := 0
+		cache.Range(func(key, value int) bool {
+			c.Assert(value, Equals, key*10, comment)
+			sum += key
+			return true
+		})
+		c.Assert(sum, Equals, 45, comment)
+
+		visited := 0
+		cache.Range(func(key, value int) bool {
+			visited++
+			return visited < 3
+		})
+		c.Assert(visited, Equals, 3, comment)
+
+		c.Assert(cache.Keys(), HasLen, 10, comment)
+		n := cache.RemoveIf(func(key, value int) bool {
+			if key%2 == 0 {
+				removed = append(removed, key)
+				return true
+			}
+			return false
+		})
+		c.Assert(n, Equals, 5, comment)
+		c.Assert(removed, HasLen, 5, comment)
+		c.Assert(cache.Len(), Equals, 5, comment)
+		for _, key := range cache.Keys() {
+			c.Assert(key%2, Equals, 1, comment)
+		}
+
+		cache.Purge()
+		c.Assert(cache.Len(), Equals, 0, comment)
+		c.Assert(cache.Keys(), HasLen, 0, comment)
+		c.Assert(cache.Stats().Evictions.Removed, Equals, uint64(10), comment)
+	}
+	caches["ttl"].(*TTL[int, int]).Close()
+
+	fifo := NewFIFOCache[int, int](10)
+	for _, key := range []int{1, 2, 1, 3} {
+		fifo.Put(key, key)
+	}
+	c.Assert(fifo.Keys(), DeepEquals, []int{1, 2, 1, 3})
+	c.Assert(fifo.RemoveIf(func(key, value int) bool { return key == 2 }), Equals, 1)
+	c.Assert(fifo.Keys(), DeepEquals, []int{1, 1, 3})
+	_, ok := fifo.Get(1)
+	c.Assert(ok, IsTrue)
+	fifo.Purge()
+	c.Assert(fifo.Len(), Equals, 0)
+	_, ok = fifo.Get(1)
+	c.Assert(ok, IsFalse)
+}
+
+func (s *testRegionCacheSuite) TestInvalidationBus(c *C) {
+	network := NewMemoryNetwork()
+	var buses []*InvalidationBus[string]
+	var caches []Cache[string, int]
+	for i := 0; i < 3; i++ {
+		bus := NewInvalidationBus[string](network.NewTransport(), GobCodec, nil)
+		cache := New[string, int](10, LRUCache)
+		cache.Put("a", 1)
+		cache.Put("b", 2)
+		bus.Register("users", cache)
+		buses = append(buses, bus)
+		caches = append(caches, cache)
+	}
+	// Caches registered under another name are not invalidated.
+	other := New[string, int](10, LRUCache)
+	other.Put("a", 1)
+	buses[1].Register("orders", other)
+
+	c.Assert(buses[0].Invalidate("users", "a"), IsNil)
+	for _, cache := range caches {
+		waitFor(c, func() bool {
+			_, ok := cache.Peek("a")
+			return !ok
+		})
+		_, ok := cache.Peek("b")
+		c.Assert(ok, IsTrue)
+	}
+	_, ok := other.Peek("a")
+	c.Assert(ok, IsTrue)
+
+	buses[2].Unregister("users")
+	c.Assert(buses[2].Close(), IsNil)
+	c.Assert(buses[2].Invalidate("users", "b"), Equals, ErrTransportClosed)
+	c.Assert(buses[1].Invalidate("users", "b"), IsNil)
+	waitFor(c, func() bool {
+		_, ok := caches[0].Peek("b")
+		return !ok
+	})
+	c.Assert(caches[2].Len(), Equals, 1)
+	for _, bus := range buses[:2] {
+		c.Assert(bus.Close(), IsNil)
+	}
+}
+
+func (s *testRegionCacheSuite) TestTCPTransport(c *C) {
+	t1, err := NewTCPTransport("127.0.0.1:0", nil)
+	c.Assert(err, IsNil)
+	t2, err := NewTCPTransport("127.0.0.1:0", []string{t1.Addr().String()})
+	c.Assert(err, IsNil)
+
+	var errs []error
+	bus1 := NewInvalidationBus[uint64](t1, JSONCodec, func(err error) { errs = append(errs, err) })
+	bus2 := NewInvalidationBus[uint64](t2, JSONCodec, nil)
+	cache := NewDefaultCache(10)
+	cache.Put(1, 1)
+	cache.Put(2, 2)
+	bus1.Register("ids", cache)
+
+	c.Assert(bus2.Invalidate("ids", 1, 2), IsNil)
+	waitFor(c, func() bool { return cache.Len() == 0 })
+
+	// The connection is redialed after the peer restarts.
+	addr := t1.Addr().String()
+	c.Assert(bus1.Close(), IsNil)
+	t1, err = NewTCPTransport(addr, nil)
+	c.Assert(err, IsNil)
+	bus1 = NewInvalidationBus[uint64](t1, JSONCodec, nil)
+	bus1.Register("ids", cache)
+	cache.Put(3, 3)
+	c.Assert(bus2.Invalidate("ids", 3), IsNil)
+	waitFor(c, func() bool { return cache.Len() == 0 })
+
+	c.Assert(bus1.Close(), IsNil)
+	c.Assert(bus2.Close(), IsNil)
+	c.Assert(errs, HasLen, 0)
+}
+
+func (s *testRegionCacheSuite) TestUDPTransport(c *C) {
+	t1, err := NewUDPTransport("239.0.0.1:19999")
+	if err != nil {
+		c.Skip("multicast is not available: " + err.Error())
+	}
+	t2, err := NewUDPTransport("239.0.0.1:19999")
+	c.Assert(err, IsNil)
+
+	bus1 := NewInvalidationBus[uint64](t1, GobCodec, nil)
+	bus2 := NewInvalidationBus[uint64](t2, GobCodec, nil)
+	cache := NewDefaultCache(10)
+	cache.Put(1, 1)
+	bus1.Register("ids", cache)
+	c.Assert(bus2.Invalidate("ids", 1), IsNil)
+	waitFor(c, func() bool { return cache.Len() == 0 })
+
+	c.Assert(bus1.Close(), IsNil)
+	c.Assert(bus2.Close(), IsNil)
+}
+
+// failingListener is a net.Listener whose Accept always fails.
+type failingListener struct {
+	net.Listener
+	accepts int32
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	atomic.AddInt32(&l.accepts, 1)
+	return nil, errors.New("too many open files")
+}
+
+func (l *failingListener) Close() error {
+	return nil
+}
+
+func (s *testRegionCacheSuite) TestTransportRetryDelay(c *C) {
+	var delay retryDelay
+	done := make(chan struct{})
+	c.Assert(delay.wait(done), IsTrue)
+	c.Assert(time.Duration(delay), Equals, transportMinRetryDelay)
+	c.Assert(delay.wait(done), IsTrue)
+	c.Assert(time.Duration(delay), Equals, 2*transportMinRetryDelay)
+	delay.reset()
+	c.Assert(delay, Equals, retryDelay(0))
+
+	// The delay is capped, and the wait stops when done is closed.
+	delay = retryDelay(transportMaxRetryDelay)
+	go func() {
+		time.Sleep(10 * time.Millisecond)
+		close(done)
+	}()
+	start := time.Now()
+	c.Assert(delay.wait(done), IsFalse)
+	c.Assert(time.Since(start) < transportMaxRetryDelay, IsTrue)
+	c.Assert(time.Duration(delay), Equals, transportMaxRetryDelay)
+	c.Assert(delay.wait(done), IsFalse)
+
+	// Accept errors do not make the loop spin.
+	listener := &failingListener{}
+	t := &TCPTransport{
+		listener: listener,
+		messages: make(chan []byte, transportBufferSize),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	t.wg.Add(1)
+	go t.accept()
+	time.Sleep(100 * time.Millisecond)
+	c.Assert(t.Close(), IsNil)
+	accepts := atomic.LoadInt32(&listener.accepts)
+	c.Assert(accepts > 1 && accepts < 10, IsTrue, Commentf("%d accepts", accepts))
+}
+
+// failingStore is a Store whose Set always fails.
+type failingStore struct {
+	Store
+}
+
+func (failingStore) Set(context.Context, string, []byte, time.Duration) error {
+	return errors.New("store is down")
+}
+
+func (s *testRegionCacheSuite) TestTieredCache(c *C) {
+	ctx := context.Background()
+	fileStore, err := NewFileStore(c.MkDir())
+	c.Assert(err, IsNil)
+
+	for _, store := range []Store{NewMemoryStore(), fileStore} {
+		comment := Commentf("%T", store)
+		tiered := NewTieredCache[int, string](NewExpirableLRU[int, string](10, time.Minute), store, GobCodec, nil, time.Minute)
+		c.Assert(tiered.Put(ctx, 1, "1"), IsNil, comment)
+		val, ok, err := tiered.Get(ctx, 1)
+		c.Assert(err, IsNil, comment)
+		c.Assert(ok, IsTrue, comment)
+		c.Assert(val, Equals, "1", comment)
+
+		// Another process shares L2 only, its L1 is populated on a L2 hit.
+		ttl := NewTTLCache[int, string](context.Background(), time.Minute, time.Minute)
+		defer ttl.Close()
+		other := NewTieredCache[int, string](ttl, store, GobCodec, nil, time.Minute)
+		_, ok = other.L1().Peek(1)
+		c.Assert(ok, IsFalse, comment)
+		val, ok, err = other.Get(ctx, 1)
+		c.Assert(err, IsNil, comment)
+		c.Assert(ok, IsTrue, comment)
+		c.Assert(val, Equals, "1", comment)
+		_, ok = other.L1().Peek(1)
+		c.Assert(ok, IsTrue, comment)
+
+		c.Assert(tiered.Remove(ctx, 1), IsNil, comment)
+		other.L1().Remove(1)
+		_, ok, err = other.Get(ctx, 1)
+		c.Assert(err, IsNil, comment)
+		c.Assert(ok, IsFalse, comment)
+		c.Assert(tiered.Remove(ctx, 1), IsNil, comment)
+
+		// Expired values are not returned from L2.
+		c.Assert(tiered.PutWithTTL(ctx, 2, "2", time.Nanosecond), IsNil, comment)
+		tiered.L1().Remove(2)
+		time.Sleep(time.Millisecond)
+		_, ok, err = tiered.Get(ctx, 2)
+		c.Assert(err, IsNil, comment)
+		c.Assert(ok, IsFalse, comment)
+
+		// L1 of both processes expires with L2.
+		c.Assert(tiered.PutWithTTL(ctx, 3, "3", 50*time.Millisecond), IsNil, comment)
+		_, ok, err = other.Get(ctx, 3)
+		c.Assert(err, IsNil, comment)
+		c.Assert(ok, IsTrue, comment)
+		time.Sleep(60 * time.Millisecond)
+		for _, t := range []*TieredCache[int, string]{tiered, other} {
+			_, ok = t.L1().Peek(3)
+			c.Assert(ok, IsFalse, comment)
+			_, ok, err = t.Get(ctx, 3)
+			c.Assert(err, IsNil, comment)
+			c.Assert(ok, IsFalse, comment)
+		}
+	}
+
+	// L1 does not keep a value which could not be written to L2.
+	for _, l1 := range []Cache[string, int]{NewExpirableLRU[string, int](10, time.Minute), New[string, int](10, LRUCache)} {
+		tiered := NewTieredCache[string, int](l1, failingStore{NewMemoryStore()}, JSONCodec, nil, 0)
+		tiered.L1().Put("a", 1)
+		c.Assert(tiered.Put(ctx, "a", 2), ErrorMatches, "store is down")
+		_, ok := tiered.L1().Peek("a")
+		c.Assert(ok, IsFalse)
+	}
+}
+
+func (s *testRegionCacheSuite) TestTieredCachePlainL1(c *C) {
+	ctx := context.Background()
+	store := NewMemoryStore()
+	// An L1 without TTL, e.g. LRU, still expires its items with L2.
+	tiered := NewTieredCache[int, string](New[int, string](10, LRUCache), store, GobCodec, nil, time.Minute)
+	other := NewTieredCache[int, string](New[int, string](10, LRUCache), store, GobCodec, nil, time.Minute)
+
+	c.Assert(tiered.PutWithTTL(ctx, 1, "1", 50*time.Millisecond), IsNil)
+	c.Assert(tiered.Put(ctx, 2, "2"), IsNil)
+	val, ok, err := other.Get(ctx, 1)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, "1")
+	time.Sleep(60 * time.Millisecond)
+	for _, t := range []*TieredCache[int, string]{tiered, other} {
+		_, ok, err = t.Get(ctx, 1)
+		c.Assert(err, IsNil)
+		c.Assert(ok, IsFalse)
+		_, ok = t.L1().Peek(1)
+		c.Assert(ok, IsFalse)
+	}
+	val, ok, err = tiered.Get(ctx, 2)
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(val, Equals, "2")
+
+	// Items which never expire from L2 have no deadline.
+	c.Assert(tiered.PutWithTTL(ctx, 1, "1", 0), IsNil)
+	_, ok = tiered.deadlines[1]
+	c.Assert(ok, IsFalse)
+
+	// The deadlines of the items evicted from L1 are pruned.
+	for i := 0; i < 10*tieredPruneMin; i++ {
+		c.Assert(tiered.Put(ctx, i, "v"), IsNil)
+	}
+	c.Assert(len(tiered.deadlines) < 2*tieredPruneMin, IsTrue)
+	c.Assert(len(tiered.deadlines) >= tiered.L1().Len(), IsTrue)
+}
+
+func (s *testRegionCacheSuite) TestFileStore(c *C) {
+	ctx := context.Background()
+	dir := filepath.Join(c.MkDir(), "store")
+	store, err := NewFileStore(dir)
+	c.Assert(err, IsNil)
+	info, err := os.Stat(dir)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0o700))
+
+	// The files can only be read by the owner.
+	c.Assert(store.Set(ctx, "a", []byte("1"), 0), IsNil)
+	info, err = os.Stat(store.path("a"))
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0o600))
+	val, expire, ok, err := store.Get(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(string(val), Equals, "1")
+	c.Assert(expire.IsZero(), IsTrue)
+
+	c.Assert(store.Set(ctx, "a", []byte("2"), time.Minute), IsNil)
+	_, expire, ok, err = store.Get(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(time.Until(expire) > 50*time.Second, IsTrue)
+
+	// A value set after an expired one was read is not removed with it.
+	c.Assert(store.Set(ctx, "a", []byte("3"), time.Nanosecond), IsNil)
+	stale, err := os.Stat(store.path("a"))
+	c.Assert(err, IsNil)
+	c.Assert(store.Set(ctx, "a", []byte("4"), 0), IsNil)
+	c.Assert(store.removeStale(store.path("a"), stale), IsNil)
+	val, _, ok, err = store.Get(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsTrue)
+	c.Assert(string(val), Equals, "4")
+
+	// The expired value itself is removed.
+	c.Assert(store.Set(ctx, "a", []byte("5"), time.Nanosecond), IsNil)
+	time.Sleep(time.Millisecond)
+	_, _, ok, err = store.Get(ctx, "a")
+	c.Assert(err, IsNil)
+	c.Assert(ok, IsFalse)
+	_, err = os.Stat(store.path("a"))
+	c.Assert(os.IsNotExist(err), IsTrue)
+	files, err := os.ReadDir(store.dir)
+	c.Assert(err, IsNil)
+	c.Assert(files, HasLen, 0)
+
+	// The files can be shared with a group.
+	dir = filepath.Join(c.MkDir(), "shared")
+	store, err = NewFileStoreWithMode(dir, 0o640)
+	c.Assert(err, IsNil)
+	c.Assert(store.Set(ctx, "a", []byte("1"), 0), IsNil)
+	info, err = os.Stat(store.path("a"))
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0o640))
+	info, err = os.Stat(dir)
+	c.Assert(err, IsNil)
+	c.Assert(info.Mode().Perm(), Equals, os.FileMode(0o750))
+}
+
+func (s *testRegionCacheSuite) TestMetrics(c *C) {
+	m := NewMetrics("cache")
+	lru := New[int, int](2, LRUCache)
+	lru.Put(1, 1)
+	lru.Put(2, 2)
+	lru.Put(3, 3)
+	lru.Get(3)
+	lru.Get(1)
+	c.Assert(m.Register("users", lru), IsNil)
+	c.Assert(m.Register("users", lru), NotNil)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	ttl := NewTTLCache[int, int](ctx, time.Minute, time.Minute)
+	ttl.Put(1, 1)
+	c.Assert(m.Register(`a"b\c`, ttl), IsNil)
+
+	srv := httptest.NewServer(m)
+	defer srv.Close()
+	resp, err := http.Get(srv.URL)
+	c.Assert(err, IsNil)
+	defer resp.Body.Close()
+	c.Assert(resp.Header.Get("Content-Type"), Equals, "text/plain; version=0.0.4; charset=utf-8")
+	body, err := io.ReadAll(resp.Body)
+	c.Assert(err, IsNil)
+
+	for _, line := range []string{
+		"# TYPE cache_items gauge",
+		`cache_items{cache="a\"b\\c"} 1`,
+		`cache_items{cache="users"} 2`,
+		`cache_capacity{cache="a\"b\\c"} 0`,
+		`cache_capacity{cache="users"} 2`,
+		"# TYPE cache_hits_total counter",
+		`cache_hits_total{cache="users"} 1`,
+		`cache_misses_total{cache="users"} 1`,
+		`cache_hit_ratio{cache="users"} 0.5`,
+		`cache_evictions_total{cache="users",reason="capacity"} 1`,
+		`cache_evictions_total{cache="users",reason="expired"} 0`,
+	} {
+		c.Assert(strings.Contains(string(body), line+"\n"), IsTrue, Commentf("%s not found in\n%s", line, body))
+	}
+	// Caches are sorted by name.
+	c.Assert(strings.Index(string(body), `cache_items{cache="a`) < strings.Index(string(body), `cache_items{cache="users"}`), IsTrue)
+
+	m.Unregister("users")
+	var buf bytes.Buffer
+	_, err = m.WriteTo(&buf)
+	c.Assert(err, IsNil)
+	c.Assert(strings.Contains(buf.String(), "users"), IsFalse)
+}
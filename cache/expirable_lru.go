@@ -0,0 +1,278 @@
+package cache
+
+import (
+	"io"
+	"sync"
+	"time"
+)
+
+var _ Cache[uint64, interface{}] = new(ExpirableLRU[uint64, interface{}])
+
+// ExpirableLRU is a fixed size LRU cache whose items also expire after
+// a TTL. Expiry is checked lazily when an item is read, and when the
+// cache is full the least recently used item is evicted whether it has
+// expired or not, so the memory is bounded without a GC goroutine.
+// ExpirableLRU is thread-safe.
+type ExpirableLRU[K comparable, V any] struct {
+	sync.Mutex
+
+	lru *LRU[K, ttlCacheItem[V]]
+	ttl time.Duration
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+}
+
+// NewExpirableLRU returns a new ExpirableLRU which holds at most size items,
+// each item expires after ttl unless it is put with PutWithTTL.
+func NewExpirableLRU[K comparable, V any](size int, ttl time.Duration) *ExpirableLRU[K, V] {
+	return NewExpirableLRUWithEvict[K, V](size, ttl, nil)
+}
+
+// NewExpirableLRUWithEvict returns a new ExpirableLRU,
+// onEvict is called whenever an item leaves the cache.
+func NewExpirableLRUWithEvict[K comparable, V any](size int, ttl time.Duration, onEvict EvictCallback[K, V]) *ExpirableLRU[K, V] {
+	stats := newStatsCounter()
+	c := &ExpirableLRU[K, V]{
+		lru:     newListLRU[K, ttlCacheItem[V]](size),
+		ttl:     ttl,
+		onEvict: countEvictions(stats, onEvict),
+		stats:   stats,
+	}
+	c.lru.onEvict = c.evicted
+	return c
+}
+
+// evicted translates the evictions of the underlying LRU.
+func (c *ExpirableLRU[K, V]) evicted(key K, item ttlCacheItem[V], reason EvictReason) {
+	if reason != EvictRemoved && item.expired(time.Now()) {
+		reason = EvictExpired
+	}
+	c.onEvict.call(key, item.value, reason)
+}
+
+// Put puts an item into cache.
+func (c *ExpirableLRU[K, V]) Put(key K, value V) {
+	c.PutWithTTL(key, value, c.ttl)
+}
+
+// PutWithTTL puts an item into cache with specified TTL.
+func (c *ExpirableLRU[K, V]) PutWithTTL(key K, value V, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.stats.put()
+	c.lru.Put(key, ttlCacheItem[V]{
+		value:  value,
+		expire: time.Now().Add(ttl),
+	})
+}
+
+// Get retrives an item from cache.
+func (c *ExpirableLRU[K, V]) Get(key K) (V, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	val, ok := c.lookup(key, true)
+	c.stats.lookup(ok)
+	return val, ok
+}
+
+// Peek reads an item from cache. The action is no considered 'Use'.
+func (c *ExpirableLRU[K, V]) Peek(key K) (V, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lookup(key, false)
+}
+
+// lookup returns an item which has not expired, an expired item is removed.
+// revive:disable-next-line:flag-parameter
+func (c *ExpirableLRU[K, V]) lookup(key K, use bool) (V, bool) {
+	var zero V
+	item, ok := c.lru.Peek(key)
+	if !ok {
+		return zero, false
+	}
+
+	if item.expired(time.Now()) {
+		c.lru.take(key)
+		c.onEvict.call(key, item.value, EvictExpired)
+		return zero, false
+	}
+
+	if use {
+		c.lru.Get(key)
+	}
+	return item.value, true
+}
+
+// Remove eliminates an item from cache.
+func (c *ExpirableLRU[K, V]) Remove(key K) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.lru.Remove(key)
+}
+
+// RemoveExpired eliminates all expired items from cache.
+func (c *ExpirableLRU[K, V]) RemoveExpired() {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	for ele := c.lru.ll.Back(); ele != nil; {
+		prev := ele.Prev()
+		kv := ele.Value.(*lruEntry[K, ttlCacheItem[V]])
+		if kv.Value.expired(now) {
+			c.lru.removeElement(ele)
+			c.onEvict.call(kv.Key, kv.Value.value, EvictExpired)
+		}
+		ele = prev
+	}
+}
+
+// Elems return all items in cache which have not expired.
+func (c *ExpirableLRU[K, V]) Elems() []*Item[K, V] {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	elems := make([]*Item[K, V], 0, c.lru.Len())
+	for ele := c.lru.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*lruEntry[K, ttlCacheItem[V]])
+		if !kv.Value.expired(now) {
+			elems = append(elems, &Item[K, V]{Key: kv.Key, Value: kv.Value.value})
+		}
+	}
+	return elems
+}
+
+// Range calls f for each item which has not expired from the most recently
+// used one until f returns false, f must not call back into the cache.
+func (c *ExpirableLRU[K, V]) Range(f func(key K, value V) bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	c.lru.rangeItems(func(key K, item ttlCacheItem[V]) bool {
+		return item.expired(now) || f(key, item.value)
+	})
+}
+
+// RemoveIf eliminates the items which have not expired and for which
+// f returns true, it returns the count.
+func (c *ExpirableLRU[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	return c.lru.removeIf(func(key K, item ttlCacheItem[V]) bool {
+		return !item.expired(now) && f(key, item.value)
+	}, c.evicted)
+}
+
+// Keys returns the keys of all items which have not expired.
+func (c *ExpirableLRU[K, V]) Keys() []K {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	keys := make([]K, 0, c.lru.Len())
+	c.lru.rangeItems(func(key K, item ttlCacheItem[V]) bool {
+		if !item.expired(now) {
+			keys = append(keys, key)
+		}
+		return true
+	})
+	return keys
+}
+
+// Purge eliminates all items from cache.
+func (c *ExpirableLRU[K, V]) Purge() {
+	c.Lock()
+	defer c.Unlock()
+
+	c.lru.removeIf(always[K, ttlCacheItem[V]], c.evicted)
+}
+
+// Len returns current cache size,
+// it includes expired items which have not been removed yet.
+func (c *ExpirableLRU[K, V]) Len() int {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lru.Len()
+}
+
+// Cost returns the total cost of items in cache, each item costs 1.
+func (c *ExpirableLRU[K, V]) Cost() int64 {
+	c.Lock()
+	defer c.Unlock()
+
+	return c.lru.Cost()
+}
+
+// Cap returns the maximum number of items.
+func (c *ExpirableLRU[K, V]) Cap() int {
+	return c.lru.maxCount
+}
+
+// Stats returns the counters of cache.
+func (c *ExpirableLRU[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Snapshot writes all items in cache which have not expired to w,
+// along with their remaining TTL. The recency order is kept.
+func (c *ExpirableLRU[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	var records []*snapshotRecord[K, V]
+	for ele := c.lru.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*lruEntry[K, ttlCacheItem[V]])
+		if !kv.Value.expired(now) {
+			records = append(records, &snapshotRecord[K, V]{
+				Key:   kv.Key,
+				Value: kv.Value.value,
+				TTL:   kv.Value.expire.Sub(now),
+			})
+		}
+	}
+
+	enc := codec.NewEncoder(w)
+	if err := writeSnapshotHeader(enc, expirableLRUSnapshot, 0, len(records)); err != nil {
+		return err
+	}
+	for _, rec := range records {
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads a snapshot from r into an empty cache. Items expire after
+// their remaining TTL when the snapshot was taken.
+func (c *ExpirableLRU[K, V]) Restore(r io.Reader, codec Codec) error {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.lru.Len() != 0 {
+		return ErrRestoreNotEmpty
+	}
+	now := time.Now()
+	dec := codec.NewDecoder(r)
+	h, err := readSnapshotHeader(dec, expirableLRUSnapshot)
+	if err != nil {
+		return err
+	}
+	return readSnapshotRecords(dec, h, func(_ int, rec *snapshotRecord[K, V]) {
+		c.lru.add(rec.Key, ttlCacheItem[V]{
+			value:  rec.Value,
+			expire: now.Add(rec.TTL),
+		})
+	})
+}
@@ -14,83 +14,292 @@
 package cache
 
 import (
-	"container/list"
+	"cmp"
+	"fmt"
+	"sort"
 	"sync"
 )
 
+// fifoEntry is a slot of FIFO, the item is replaced as a whole
+// on dedup so that items returned by Elems are never modified.
+type fifoEntry[K cmp.Ordered, V any] struct {
+	item *Item[K, V]
+}
+
 // FIFO is 'First-In-First-Out' cache.
-type FIFO struct {
+type FIFO[K cmp.Ordered, V any] struct {
 	sync.RWMutex
 
 	// maxCount is the maximum number of items.
 	// 0 means no limit.
 	maxCount int
+	// dedup replaces the value of an existing key in place on Put,
+	// instead of appending a duplicate item.
+	dedup bool
+
+	// entries holds the items from the oldest one,
+	// entries before head have been removed.
+	entries []*fifoEntry[K, V]
+	head    int
+	// keys indexes the newest entry of each key.
+	keys map[K]*fifoEntry[K, V]
+	// sorted reports whether keys were put in non-decreasing order,
+	// e.g. sequence numbers, so FromElems can use binary search.
+	sorted bool
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+}
 
-	ll *list.List
+// NewFIFO returns a new uint64 keyed FIFO cache.
+func NewFIFO(maxCount int) *FIFO[uint64, interface{}] {
+	return NewFIFOCache[uint64, interface{}](maxCount)
 }
 
-// NewFIFO returns a new FIFO cache.
-func NewFIFO(maxCount int) *FIFO {
-	return &FIFO{
+// NewFIFOCache returns a new FIFO cache.
+func NewFIFOCache[K cmp.Ordered, V any](maxCount int) *FIFO[K, V] {
+	return NewFIFOCacheWithEvict[K, V](maxCount, nil)
+}
+
+// NewFIFOCacheWithEvict returns a new FIFO cache,
+// onEvict is called whenever an item leaves the cache.
+func NewFIFOCacheWithEvict[K cmp.Ordered, V any](maxCount int, onEvict EvictCallback[K, V]) *FIFO[K, V] {
+	stats := newStatsCounter()
+	return &FIFO[K, V]{
 		maxCount: maxCount,
-		ll:       list.New(),
+		keys:     make(map[K]*fifoEntry[K, V]),
+		sorted:   true,
+		onEvict:  countEvictions(stats, onEvict),
+		stats:    stats,
 	}
 }
 
+// NewFIFOWithOptions returns a new FIFO cache configured by options,
+// only WithDedup and WithOnEvict apply to FIFO.
+func NewFIFOWithOptions[K cmp.Ordered, V any](maxCount int, opts ...Option) (*FIFO[K, V], error) {
+	if maxCount < 0 {
+		return nil, fmt.Errorf("%w: size %d", ErrInvalidOption, maxCount)
+	}
+	s, err := applyOptions(opts, forFIFO, "FIFO")
+	if err != nil {
+		return nil, err
+	}
+	onEvict, err := evictCallback[K, V](s)
+	if err != nil {
+		return nil, err
+	}
+
+	c := NewFIFOCacheWithEvict[K, V](maxCount, onEvict)
+	c.dedup = s.dedup
+	return c, nil
+}
+
 // Put puts an item into cache.
-func (c *FIFO) Put(key uint64, value interface{}) {
+// If dedup is enabled, the value of an existing key is replaced in place.
+func (c *FIFO[K, V]) Put(key K, value V) {
 	c.Lock()
 	defer c.Unlock()
 
-	kv := &Item{Key: key, Value: value}
-	c.ll.PushFront(kv)
+	c.stats.put()
+	kv := &Item[K, V]{Key: key, Value: value}
+
+	if e, ok := c.keys[key]; ok && c.dedup {
+		old := e.item
+		e.item = kv
+		c.onEvict.call(key, old.Value, EvictReplaced)
+		return
+	}
+
+	if c.len() > 0 && key < c.entries[len(c.entries)-1].item.Key {
+		c.sorted = false
+	}
+	e := &fifoEntry[K, V]{item: kv}
+	c.entries = append(c.entries, e)
+	c.keys[key] = e
 
-	if c.maxCount != 0 && c.ll.Len() > c.maxCount {
-		c.ll.Remove(c.ll.Back())
+	if c.maxCount != 0 && c.len() > c.maxCount {
+		kv := c.removeOldest()
+		c.onEvict.call(kv.Key, kv.Value, EvictCapacity)
 	}
 }
 
-// Remove takes the oldest item out.
-func (c *FIFO) Remove() {
+// Get retrives the newest item of key from cache.
+func (c *FIFO[K, V]) Get(key K) (V, bool) {
+	val, ok := c.Peek(key)
+	c.stats.lookup(ok)
+	return val, ok
+}
+
+// Peek reads the newest item of key from cache. The action is no considered 'Use'.
+func (c *FIFO[K, V]) Peek(key K) (V, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	if e, ok := c.keys[key]; ok {
+		return e.item.Value, true
+	}
+	var zero V
+	return zero, false
+}
+
+// Remove takes the oldest item out,
+// it returns false if the cache is empty.
+func (c *FIFO[K, V]) Remove() bool {
 	c.Lock()
 	defer c.Unlock()
 
-	c.ll.Remove(c.ll.Back())
+	if c.len() == 0 {
+		return false
+	}
+	kv := c.removeOldest()
+	c.onEvict.call(kv.Key, kv.Value, EvictRemoved)
+	return true
+}
+
+func (c *FIFO[K, V]) removeOldest() *Item[K, V] {
+	e := c.entries[c.head]
+	c.entries[c.head] = nil
+	c.head++
+	if c.keys[e.item.Key] == e {
+		delete(c.keys, e.item.Key)
+	}
+
+	switch {
+	case c.head == len(c.entries):
+		c.entries = c.entries[:0]
+		c.head = 0
+		c.sorted = true
+	case c.head >= len(c.entries)/2:
+		// Reclaim the removed slots once they are half of the buffer,
+		// which keeps removal amortized O(1).
+		n := copy(c.entries, c.entries[c.head:])
+		clear(c.entries[n:])
+		c.entries = c.entries[:n]
+		c.head = 0
+	}
+	return e.item
+}
+
+func (c *FIFO[K, V]) len() int {
+	return len(c.entries) - c.head
 }
 
 // Elems returns all items in cache.
-func (c *FIFO) Elems() []*Item {
+func (c *FIFO[K, V]) Elems() []*Item[K, V] {
 	c.RLock()
 	defer c.RUnlock()
 
-	elems := make([]*Item, 0, c.ll.Len())
-	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
-		elems = append(elems, ele.Value.(*Item))
+	elems := make([]*Item[K, V], 0, c.len())
+	for _, e := range c.entries[c.head:] {
+		elems = append(elems, e.item)
 	}
 
 	return elems
 }
 
 // FromElems returns all items that has a key greater than the specified one.
-func (c *FIFO) FromElems(key uint64) []*Item {
+// If keys were put in non-decreasing order, e.g. sequence numbers, the first
+// item is found by binary search, otherwise all items are scanned.
+func (c *FIFO[K, V]) FromElems(key K) []*Item[K, V] {
 	c.RLock()
 	defer c.RUnlock()
 
-	elems := make([]*Item, 0, c.ll.Len())
-	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
-		kv := ele.Value.(*Item)
-		if kv.Key > key {
-			elems = append(elems, ele.Value.(*Item))
+	entries := c.entries[c.head:]
+	if c.sorted {
+		i := sort.Search(len(entries), func(i int) bool {
+			return entries[i].item.Key > key
+		})
+		elems := make([]*Item[K, V], 0, len(entries)-i)
+		for _, e := range entries[i:] {
+			elems = append(elems, e.item)
+		}
+		return elems
+	}
+
+	elems := make([]*Item[K, V], 0, len(entries))
+	for _, e := range entries {
+		if e.item.Key > key {
+			elems = append(elems, e.item)
 		}
 	}
 
 	return elems
 }
 
+// Range calls f for each item from the oldest one until f returns false,
+// f must not call back into the cache.
+func (c *FIFO[K, V]) Range(f func(key K, value V) bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	for _, e := range c.entries[c.head:] {
+		if !f(e.item.Key, e.item.Value) {
+			return
+		}
+	}
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *FIFO[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	c.Lock()
+	defer c.Unlock()
+
+	entries := c.entries[:0]
+	n := 0
+	for _, e := range c.entries[c.head:] {
+		if !f(e.item.Key, e.item.Value) {
+			entries = append(entries, e)
+			continue
+		}
+		c.onEvict.call(e.item.Key, e.item.Value, EvictRemoved)
+		n++
+	}
+	clear(c.entries[len(entries):])
+	c.entries = entries
+	c.head = 0
+
+	// An older duplicate of a removed key becomes the newest one.
+	clear(c.keys)
+	for _, e := range entries {
+		c.keys[e.item.Key] = e
+	}
+	if len(entries) == 0 {
+		c.sorted = true
+	}
+	return n
+}
+
+// Keys returns the keys of all items from the oldest one.
+func (c *FIFO[K, V]) Keys() []K {
+	c.RLock()
+	defer c.RUnlock()
+
+	keys := make([]K, 0, c.len())
+	for _, e := range c.entries[c.head:] {
+		keys = append(keys, e.item.Key)
+	}
+	return keys
+}
+
+// Purge eliminates all items from cache.
+func (c *FIFO[K, V]) Purge() {
+	c.RemoveIf(always[K, V])
+}
+
+// Stats returns the counters of cache.
+func (c *FIFO[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Cap returns the maximum number of items, 0 means no limit.
+func (c *FIFO[K, V]) Cap() int {
+	return c.maxCount
+}
+
 // Len returns current cache size.
-func (c *FIFO) Len() int {
+func (c *FIFO[K, V]) Len() int {
 	c.RLock()
 	defer c.RUnlock()
 
-	return c.ll.Len()
+	return c.len()
 }
@@ -0,0 +1,175 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+const (
+	// fileStoreHeaderSize is the size of the expire time before the value.
+	fileStoreHeaderSize = 8
+	// fileStorePerm is the default permission of the files, the values
+	// may be private so only the owner can read them.
+	fileStorePerm = 0o600
+)
+
+// FileStore is a Store which saves each key in a file of a directory,
+// it can be shared by the processes of a host. Expired files are removed
+// when read.
+type FileStore struct {
+	dir  string
+	perm fs.FileMode
+}
+
+// NewFileStore returns a new FileStore in dir, dir is created if it does not exist.
+// The files can only be accessed by the owner, see NewFileStoreWithMode.
+func NewFileStore(dir string) (*FileStore, error) {
+	return NewFileStoreWithMode(dir, fileStorePerm)
+}
+
+// NewFileStoreWithMode returns a new FileStore in dir whose files have the
+// permission perm, e.g. 0o640 to share them with the processes of a group.
+// dir is created if it does not exist, it can be searched by whoever can
+// read the files.
+func NewFileStoreWithMode(dir string, perm fs.FileMode) (*FileStore, error) {
+	perm &= fs.ModePerm
+	if err := os.MkdirAll(dir, perm|(perm&0o444)>>2); err != nil {
+		return nil, err
+	}
+	return &FileStore{dir: dir, perm: perm}, nil
+}
+
+// path returns the file of key, the key is hashed so that it is a valid file name.
+func (s *FileStore) path(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(s.dir, hex.EncodeToString(sum[:]))
+}
+
+// Get returns the value of key and its expire time.
+func (s *FileStore) Get(ctx context.Context, key string) ([]byte, time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	path := s.path(key)
+	f, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, time.Time{}, false, nil
+	}
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	defer f.Close()
+
+	data, err := io.ReadAll(f)
+	if err != nil {
+		return nil, time.Time{}, false, err
+	}
+	if len(data) < fileStoreHeaderSize {
+		return nil, time.Time{}, false, errors.New("corrupted cache file: " + path)
+	}
+
+	var expire time.Time
+	if nsec := int64(binary.BigEndian.Uint64(data)); nsec != 0 {
+		expire = time.Unix(0, nsec)
+	}
+	if !expire.IsZero() && expire.Before(time.Now()) {
+		info, err := f.Stat()
+		if err != nil {
+			return nil, time.Time{}, false, err
+		}
+		return nil, time.Time{}, false, s.removeStale(path, info)
+	}
+	return data[fileStoreHeaderSize:], expire, true, nil
+}
+
+// removeStale removes the expired file stale from path. Another process
+// may have renamed a new file to path since stale was read, so the file
+// at path is moved away first, and linked back unless it is stale.
+func (s *FileStore) removeStale(path string, stale fs.FileInfo) error {
+	f, err := os.CreateTemp(s.dir, ".stale-*")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	f.Close()
+	defer os.Remove(tmp)
+
+	if err = os.Rename(path, tmp); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	info, err := os.Stat(tmp)
+	if err != nil {
+		return err
+	}
+	if os.SameFile(info, stale) {
+		return nil
+	}
+	// The link fails if a newer file has been set meanwhile.
+	if err = os.Link(tmp, path); err != nil && !errors.Is(err, fs.ErrExist) {
+		return err
+	}
+	return nil
+}
+
+// Set sets the value of key which expires after ttl. The file is replaced
+// atomically, so readers never see a partial value.
+func (s *FileStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	data := make([]byte, fileStoreHeaderSize+len(value))
+	if ttl > 0 {
+		binary.BigEndian.PutUint64(data, uint64(time.Now().Add(ttl).UnixNano()))
+	}
+	copy(data[fileStoreHeaderSize:], value)
+
+	f, err := os.CreateTemp(s.dir, ".tmp-*")
+	if err != nil {
+		return err
+	}
+	// CreateTemp creates the file with 0o600, whatever perm is.
+	if err = f.Chmod(s.perm); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if _, err = f.Write(data); err != nil {
+		f.Close()
+		os.Remove(f.Name())
+		return err
+	}
+	if err = f.Close(); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	if err = os.Rename(f.Name(), s.path(key)); err != nil {
+		os.Remove(f.Name())
+		return err
+	}
+	return nil
+}
+
+// Delete removes key.
+func (s *FileStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(s.path(key)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,232 @@
+package cache
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"sync"
+)
+
+var (
+	// ErrTransportClosed is returned when sending on a closed Transport
+	ErrTransportClosed = errors.New("transport closed")
+)
+
+// Transport delivers invalidation messages between processes.
+type Transport interface {
+	// Broadcast sends msg to the other processes, it may be delivered
+	// back to the sender as well.
+	Broadcast(msg []byte) error
+	// Messages returns the channel of received messages,
+	// it is closed when the transport is closed.
+	Messages() <-chan []byte
+	// Close stops the transport.
+	Close() error
+}
+
+// Remover is the part of a cache used by InvalidationBus,
+// it is implemented by Cache and TTL.
+type Remover[K comparable] interface {
+	// Remove eliminates an item from cache.
+	Remove(key K)
+}
+
+// invalidation is the message broadcast by InvalidationBus.
+type invalidation[K comparable] struct {
+	// Origin is the bus which sent the message, a bus ignores its own messages.
+	Origin string
+	// Cache is the name of the registered cache.
+	Cache string
+	Keys  []K
+}
+
+// InvalidationBus keeps the local caches of many processes consistent.
+// Invalidate removes keys from a registered cache and broadcasts the keys
+// over the transport, and every other bus removes them from its cache
+// registered under the same name.
+type InvalidationBus[K comparable] struct {
+	id        string
+	transport Transport
+	codec     Codec
+	onError   func(err error)
+
+	mu     sync.RWMutex
+	caches map[string]Remover[K]
+
+	done chan struct{}
+}
+
+// NewInvalidationBus returns a new InvalidationBus over transport, messages
+// are encoded by codec. onError is called with the errors of decoding
+// received messages, it may be nil.
+func NewInvalidationBus[K comparable](transport Transport, codec Codec, onError func(err error)) *InvalidationBus[K] {
+	b := &InvalidationBus[K]{
+		id:        newBusID(),
+		transport: transport,
+		codec:     codec,
+		onError:   onError,
+		caches:    make(map[string]Remover[K]),
+		done:      make(chan struct{}),
+	}
+
+	go b.receive()
+	return b
+}
+
+// newBusID returns a random id of a bus.
+func newBusID() string {
+	buf := make([]byte, 16)
+	if _, err := rand.Read(buf); err != nil {
+		panic(fmt.Errorf("failed to read random bytes: %v", err))
+	}
+	return hex.EncodeToString(buf)
+}
+
+// Register adds a cache to be invalidated by the messages for name.
+func (b *InvalidationBus[K]) Register(name string, c Remover[K]) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.caches[name] = c
+}
+
+// Unregister removes the cache registered under name.
+func (b *InvalidationBus[K]) Unregister(name string) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	delete(b.caches, name)
+}
+
+// Invalidate removes keys from the cache registered under name,
+// and from the caches of the same name in other processes.
+func (b *InvalidationBus[K]) Invalidate(name string, keys ...K) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	b.remove(name, keys)
+
+	var buf bytes.Buffer
+	msg := &invalidation[K]{Origin: b.id, Cache: name, Keys: keys}
+	if err := b.codec.NewEncoder(&buf).Encode(msg); err != nil {
+		return err
+	}
+	return b.transport.Broadcast(buf.Bytes())
+}
+
+func (b *InvalidationBus[K]) remove(name string, keys []K) {
+	b.mu.RLock()
+	c, ok := b.caches[name]
+	b.mu.RUnlock()
+
+	if ok {
+		for _, key := range keys {
+			c.Remove(key)
+		}
+	}
+}
+
+func (b *InvalidationBus[K]) receive() {
+	defer close(b.done)
+
+	for data := range b.transport.Messages() {
+		msg := new(invalidation[K])
+		if err := b.codec.NewDecoder(bytes.NewReader(data)).Decode(msg); err != nil {
+			if b.onError != nil {
+				b.onError(err)
+			}
+			continue
+		}
+		if msg.Origin != b.id {
+			b.remove(msg.Cache, msg.Keys)
+		}
+	}
+}
+
+// Close closes the transport and waits for the received messages to be applied.
+func (b *InvalidationBus[K]) Close() error {
+	err := b.transport.Close()
+	<-b.done
+	return err
+}
+
+// MemoryNetwork connects the memory transports created by it,
+// it is used to test InvalidationBus in a single process.
+type MemoryNetwork struct {
+	mu      sync.RWMutex
+	members map[*memoryTransport]struct{}
+}
+
+// NewMemoryNetwork returns a new MemoryNetwork.
+func NewMemoryNetwork() *MemoryNetwork {
+	return &MemoryNetwork{
+		members: make(map[*memoryTransport]struct{}),
+	}
+}
+
+// NewTransport returns a new Transport connected to the network.
+func (n *MemoryNetwork) NewTransport() Transport {
+	t := &memoryTransport{
+		network:  n,
+		messages: make(chan []byte, transportBufferSize),
+		done:     make(chan struct{}),
+	}
+
+	n.mu.Lock()
+	n.members[t] = struct{}{}
+	n.mu.Unlock()
+	return t
+}
+
+type memoryTransport struct {
+	network  *MemoryNetwork
+	messages chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+func (t *memoryTransport) Broadcast(msg []byte) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+
+	t.network.mu.RLock()
+	defer t.network.mu.RUnlock()
+
+	for m := range t.network.members {
+		if m != t {
+			m.deliver(msg)
+		}
+	}
+	return nil
+}
+
+// deliver blocks until msg is received or the transport is closed.
+func (t *memoryTransport) deliver(msg []byte) {
+	select {
+	case t.messages <- msg:
+	case <-t.done:
+	}
+}
+
+func (t *memoryTransport) Messages() <-chan []byte {
+	return t.messages
+}
+
+func (t *memoryTransport) Close() error {
+	t.closeOnce.Do(func() {
+		// done is closed first to release the broadcasts blocked on t,
+		// which hold the read lock of network.
+		close(t.done)
+		t.network.mu.Lock()
+		delete(t.network.members, t)
+		t.network.mu.Unlock()
+		close(t.messages)
+	})
+	return nil
+}
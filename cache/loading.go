@@ -0,0 +1,156 @@
+package cache
+
+import (
+	"context"
+	"errors"
+	"sync"
+)
+
+var (
+	// ErrLoaderPanicked is returned to callers waiting for a loader which panicked
+	ErrLoaderPanicked = errors.New("cache loader panicked")
+)
+
+// ReadWriter is the part of a cache used by LoadingCache,
+// it is implemented by Cache and TTL.
+type ReadWriter[K comparable, V any] interface {
+	// Get retrives an item from cache.
+	Get(key K) (V, bool)
+	// Peek reads an item from cache. The action is no considered 'Use'.
+	Peek(key K) (V, bool)
+	// Put puts an item into cache.
+	Put(key K, value V)
+	// Remove eliminates an item from cache.
+	Remove(key K)
+}
+
+// Loader loads the value of key on a cache miss.
+type Loader[K comparable, V any] func(ctx context.Context, key K) (V, error)
+
+// loadCall is an in-flight or completed Loader call.
+type loadCall[V any] struct {
+	done  chan struct{}
+	value V
+	err   error
+	// panicked is the value the loader panicked with.
+	panicked interface{}
+	// superseded means the key was put or removed while loading, so the
+	// loaded value is stale and not put into cache. It is guarded by the
+	// mu of LoadingCache.
+	superseded bool
+}
+
+// LoadingCache is a read-through cache. On a miss it calls the loader and
+// puts the result into the underlying cache. Concurrent misses on the same
+// key share a single loader call, so a hot key that expires does not cause
+// a thundering herd on the backend.
+type LoadingCache[K comparable, V any] struct {
+	cache  ReadWriter[K, V]
+	loader Loader[K, V]
+
+	mu    sync.Mutex
+	calls map[K]*loadCall[V]
+}
+
+// NewLoadingCache returns a LoadingCache over cache.
+// cache must be thread-safe, e.g. created by New or NewTTL.
+func NewLoadingCache[K comparable, V any](cache ReadWriter[K, V], loader Loader[K, V]) *LoadingCache[K, V] {
+	return &LoadingCache[K, V]{
+		cache:  cache,
+		loader: loader,
+		calls:  make(map[K]*loadCall[V]),
+	}
+}
+
+// Get retrives an item from cache, the item is loaded on a cache miss.
+// Loader errors are returned to every caller waiting for the key and are
+// not cached. Each caller stops waiting when its own ctx is done, while
+// the loader runs with the values but without the cancellation of the
+// ctx of the caller which started it, so the other callers still get the
+// result. If the loader panics, that caller panics with the same value
+// and the others get ErrLoaderPanicked.
+func (c *LoadingCache[K, V]) Get(ctx context.Context, key K) (V, error) {
+	if val, ok := c.cache.Get(key); ok {
+		return val, nil
+	}
+
+	c.mu.Lock()
+	if call, ok := c.calls[key]; ok {
+		c.mu.Unlock()
+		return c.wait(ctx, call, false)
+	}
+	// A load may have completed since the cache was read.
+	if val, ok := c.cache.Peek(key); ok {
+		c.mu.Unlock()
+		return val, nil
+	}
+	call := &loadCall[V]{done: make(chan struct{})}
+	c.calls[key] = call
+	c.mu.Unlock()
+
+	go c.load(context.WithoutCancel(ctx), key, call)
+	return c.wait(ctx, call, true)
+}
+
+// wait returns the result of call unless ctx is done first,
+// the caller which started call panics if the loader panicked.
+// revive:disable-next-line:flag-parameter
+func (c *LoadingCache[K, V]) wait(ctx context.Context, call *loadCall[V], started bool) (V, error) {
+	select {
+	case <-call.done:
+		if started && call.panicked != nil {
+			panic(call.panicked)
+		}
+		return call.value, call.err
+	case <-ctx.Done():
+		var zero V
+		return zero, ctx.Err()
+	}
+}
+
+func (c *LoadingCache[K, V]) load(ctx context.Context, key K, call *loadCall[V]) {
+	// Waiters must be released even if the loader panics.
+	defer func() {
+		if r := recover(); r != nil {
+			call.panicked = r
+			call.err = ErrLoaderPanicked
+		}
+		c.mu.Lock()
+		delete(c.calls, key)
+		c.mu.Unlock()
+		close(call.done)
+	}()
+
+	call.value, call.err = c.loader(ctx, key)
+	if call.err != nil {
+		return
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if !call.superseded {
+		c.cache.Put(key, call.value)
+	}
+}
+
+// Put puts an item into cache. A load of key in flight is not put into
+// cache when it completes, its waiters still get the loaded value.
+func (c *LoadingCache[K, V]) Put(key K, value V) {
+	c.supersede(key)
+	c.cache.Put(key, value)
+}
+
+// Remove eliminates an item from cache. Like Put, a load of key in flight
+// is not put into cache when it completes.
+func (c *LoadingCache[K, V]) Remove(key K) {
+	c.supersede(key)
+	c.cache.Remove(key)
+}
+
+// supersede marks the load of key in flight as superseded.
+func (c *LoadingCache[K, V]) supersede(key K) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if call, ok := c.calls[key]; ok {
+		call.superseded = true
+	}
+}
@@ -15,122 +15,347 @@ package cache
 
 import (
 	"container/list"
+	"io"
 )
 
 // Item is the cache entry.
-type Item struct {
-	Key   uint64
-	Value interface{}
+type Item[K comparable, V any] struct {
+	Key   K
+	Value V
+}
+
+// lruEntry is the list element value of LRU.
+type lruEntry[K comparable, V any] struct {
+	Item[K, V]
+	cost int64
 }
 
 // LRU is 'Least-Recently-Used' cache.
-type LRU struct {
+type LRU[K comparable, V any] struct {
 	// maxCount is the maximum number of items.
 	// 0 means no limit.
 	maxCount int
+	// maxCost is the maximum total cost of items.
+	// 0 means no limit.
+	maxCost int64
+	// cost returns the cost of a value, each item costs 1 if it is nil.
+	cost CostFunc[V]
+	// totalCost is the total cost of items.
+	totalCost int64
 
 	ll    *list.List
-	cache map[uint64]*list.Element
+	cache map[K]*list.Element
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+}
+
+// newLRU returns a new uint64 keyed lru cache.
+func newLRU(maxCount int) *LRU[uint64, interface{}] {
+	return newTypedLRU[uint64, interface{}](maxCount, nil)
 }
 
-// newLRU returns a new lru cache. And this LRU cache is not thread-safe
-// should not use this function to create LRU cache, use NewCache instead
-func newLRU(maxCount int) *LRU {
-	return &LRU{
+// newTypedLRU returns a new lru cache. And this LRU cache is not thread-safe
+// should not use this function to create LRU cache, use New instead
+func newTypedLRU[K comparable, V any](maxCount int, onEvict EvictCallback[K, V]) *LRU[K, V] {
+	stats := newStatsCounter()
+	return &LRU[K, V]{
 		maxCount: maxCount,
 		ll:       list.New(),
-		cache:    make(map[uint64]*list.Element),
+		cache:    make(map[K]*list.Element),
+		onEvict:  countEvictions(stats, onEvict),
+		stats:    stats,
 	}
 }
 
+// newListLRU returns a lru cache used as a list inside another cache,
+// it neither calls back on eviction nor collects stats.
+func newListLRU[K comparable, V any](maxCount int) *LRU[K, V] {
+	return &LRU[K, V]{
+		maxCount: maxCount,
+		ll:       list.New(),
+		cache:    make(map[K]*list.Element),
+	}
+}
+
+// withCost bounds the cache by the total cost of items as well.
+func (c *LRU[K, V]) withCost(maxCost int64, cost CostFunc[V]) *LRU[K, V] {
+	c.maxCost = maxCost
+	c.cost = cost
+	return c
+}
+
+func (c *LRU[K, V]) costOf(value V) int64 {
+	if c.cost == nil {
+		return 1
+	}
+	return c.cost(value)
+}
+
 // Put puts an item into cache.
-func (c *LRU) Put(key uint64, value interface{}) {
+func (c *LRU[K, V]) Put(key K, value V) {
+	c.stats.put()
+	c.add(key, value)
+}
+
+func (c *LRU[K, V]) add(key K, value V) {
+	cost := c.costOf(value)
+	if c.maxCost != 0 && cost > c.maxCost {
+		// The item can never fit, so it is evicted right away
+		// instead of flushing the whole cache to make room for it.
+		if old, ok := c.take(key); ok {
+			c.onEvict.call(key, old, EvictReplaced)
+		}
+		c.onEvict.call(key, value, EvictCapacity)
+		return
+	}
+
 	if ele, ok := c.cache[key]; ok {
 		c.ll.MoveToFront(ele)
-		ele.Value.(*Item).Value = value
-		return
+		kv := ele.Value.(*lruEntry[K, V])
+		old := kv.Value
+		kv.Value = value
+		c.totalCost += cost - kv.cost
+		kv.cost = cost
+		c.onEvict.call(key, old, EvictReplaced)
+	} else {
+		kv := &lruEntry[K, V]{Item: Item[K, V]{Key: key, Value: value}, cost: cost}
+		ele := c.ll.PushFront(kv)
+		c.cache[key] = ele
+		c.totalCost += cost
 	}
 
-	kv := &Item{Key: key, Value: value}
-	ele := c.ll.PushFront(kv)
-	c.cache[key] = ele
-	if c.maxCount != 0 && c.ll.Len() > c.maxCount {
+	for c.overflow() {
 		c.removeOldest()
 	}
 }
 
+// overflow reports whether the cache exceeds its limits.
+func (c *LRU[K, V]) overflow() bool {
+	if c.maxCount != 0 && c.ll.Len() > c.maxCount {
+		return true
+	}
+	return c.maxCost != 0 && c.totalCost > c.maxCost
+}
+
 // Get retrives an item from cache.
-func (c *LRU) Get(key uint64) (interface{}, bool) {
+func (c *LRU[K, V]) Get(key K) (V, bool) {
 	if ele, ok := c.cache[key]; ok {
+		c.stats.hit()
 		c.ll.MoveToFront(ele)
-		return ele.Value.(*Item).Value, true
+		return ele.Value.(*lruEntry[K, V]).Value, true
 	}
 
-	return nil, false
+	c.stats.miss()
+	var zero V
+	return zero, false
 }
 
 // Peek reads an item from cache. The action is no considered 'Use'.
-func (c *LRU) Peek(key uint64) (interface{}, bool) {
+func (c *LRU[K, V]) Peek(key K) (V, bool) {
 	if ele, ok := c.cache[key]; ok {
-		return ele.Value.(*Item).Value, true
+		return ele.Value.(*lruEntry[K, V]).Value, true
 	}
 
-	return nil, false
+	var zero V
+	return zero, false
 }
 
-func (c *LRU) contains(key uint64) bool {
+func (c *LRU[K, V]) contains(key K) bool {
 	_, ok := c.cache[key]
 	return ok
 }
 
 // Remove eliminates an item from cache.
-func (c *LRU) Remove(key uint64) {
-	c.remove(key)
+func (c *LRU[K, V]) Remove(key K) {
+	if val, ok := c.take(key); ok {
+		c.onEvict.call(key, val, EvictRemoved)
+	}
 }
 
 // revive:disable-next-line:confusing-naming
-func (c *LRU) remove(key uint64) bool {
+func (c *LRU[K, V]) remove(key K) bool {
+	_, ok := c.take(key)
+	return ok
+}
+
+// take removes an item and returns its value without invoking onEvict,
+// it is used when the item only moves to another list.
+func (c *LRU[K, V]) take(key K) (V, bool) {
 	if ele, ok := c.cache[key]; ok {
 		c.removeElement(ele)
-		return ok
+		return ele.Value.(*lruEntry[K, V]).Value, ok
 	}
-	return false
+	var zero V
+	return zero, false
 }
 
-func (c *LRU) removeOldest() {
+func (c *LRU[K, V]) removeOldest() {
 	ele := c.ll.Back()
 	if ele != nil {
 		c.removeElement(ele)
+		kv := ele.Value.(*lruEntry[K, V])
+		c.onEvict.call(kv.Key, kv.Value, EvictCapacity)
 	}
 }
 
-func (c *LRU) getAndRemoveOldest() (uint64, interface{}, bool) {
+// oldest returns the oldest item without removing it.
+func (c *LRU[K, V]) oldest() (K, V, bool) {
+	ele := c.ll.Back()
+	if ele != nil {
+		kv := ele.Value.(*lruEntry[K, V])
+		return kv.Key, kv.Value, true
+	}
+	var (
+		zeroKey   K
+		zeroValue V
+	)
+	return zeroKey, zeroValue, false
+}
+
+// getAndRemoveOldest removes the oldest item without invoking onEvict.
+func (c *LRU[K, V]) getAndRemoveOldest() (K, V, bool) {
 	ele := c.ll.Back()
 	if ele != nil {
 		c.removeElement(ele)
-		return ele.Value.(*Item).Key, ele.Value.(*Item).Value, true
+		kv := ele.Value.(*lruEntry[K, V])
+		return kv.Key, kv.Value, true
 	}
-	return 0, nil, false
+	var (
+		zeroKey   K
+		zeroValue V
+	)
+	return zeroKey, zeroValue, false
 }
 
-func (c *LRU) removeElement(ele *list.Element) {
+func (c *LRU[K, V]) removeElement(ele *list.Element) {
 	c.ll.Remove(ele)
-	kv := ele.Value.(*Item)
+	kv := ele.Value.(*lruEntry[K, V])
 	delete(c.cache, kv.Key)
+	c.totalCost -= kv.cost
 }
 
 // Elems return all items in cache.
-func (c *LRU) Elems() []*Item {
-	elems := make([]*Item, 0, c.ll.Len())
+func (c *LRU[K, V]) Elems() []*Item[K, V] {
+	elems := make([]*Item[K, V], 0, c.ll.Len())
 	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
-		clone := *(ele.Value.(*Item))
+		clone := ele.Value.(*lruEntry[K, V]).Item
 		elems = append(elems, &clone)
 	}
 
 	return elems
 }
 
+// Range calls f for each item from the most recently used one
+// until f returns false.
+func (c *LRU[K, V]) Range(f func(key K, value V) bool) {
+	c.rangeItems(f)
+}
+
+// rangeItems reports whether all items have been visited.
+func (c *LRU[K, V]) rangeItems(f func(key K, value V) bool) bool {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		kv := ele.Value.(*lruEntry[K, V])
+		if !f(kv.Key, kv.Value) {
+			return false
+		}
+	}
+	return true
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *LRU[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	return c.removeIf(f, c.onEvict)
+}
+
+// removeIf eliminates the items for which f returns true,
+// onRemoved is called for each of them instead of onEvict.
+func (c *LRU[K, V]) removeIf(f func(key K, value V) bool, onRemoved EvictCallback[K, V]) int {
+	n := 0
+	for ele := c.ll.Front(); ele != nil; {
+		next := ele.Next()
+		kv := ele.Value.(*lruEntry[K, V])
+		if f(kv.Key, kv.Value) {
+			c.removeElement(ele)
+			onRemoved.call(kv.Key, kv.Value, EvictRemoved)
+			n++
+		}
+		ele = next
+	}
+	return n
+}
+
+// Keys returns the keys of all items in cache.
+func (c *LRU[K, V]) Keys() []K {
+	return c.appendKeys(make([]K, 0, c.ll.Len()))
+}
+
+func (c *LRU[K, V]) appendKeys(keys []K) []K {
+	for ele := c.ll.Front(); ele != nil; ele = ele.Next() {
+		keys = append(keys, ele.Value.(*lruEntry[K, V]).Key)
+	}
+	return keys
+}
+
+// Purge eliminates all items from cache.
+func (c *LRU[K, V]) Purge() {
+	c.removeIf(always[K, V], c.onEvict)
+}
+
 // Len returns current cache size.
-func (c *LRU) Len() int {
+func (c *LRU[K, V]) Len() int {
 	return c.ll.Len()
 }
+
+// Cost returns the total cost of items in cache.
+func (c *LRU[K, V]) Cost() int64 {
+	return c.totalCost
+}
+
+// Cap returns the maximum number of items, 0 means no limit.
+func (c *LRU[K, V]) Cap() int {
+	return c.maxCount
+}
+
+// Stats returns the counters of cache.
+func (c *LRU[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Snapshot writes all items in cache to w, the recency order is kept.
+func (c *LRU[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	return c.snapshot(codec.NewEncoder(w))
+}
+
+// Restore reads a snapshot from r into an empty cache.
+func (c *LRU[K, V]) Restore(r io.Reader, codec Codec) error {
+	return restoreSnapshot[K, V](c, codec.NewDecoder(r))
+}
+
+func (c *LRU[K, V]) snapshotKind() string {
+	return lruSnapshot
+}
+
+func (c *LRU[K, V]) snapshot(enc Encoder) error {
+	if err := writeSnapshotHeader(enc, lruSnapshot, 0, c.Len()); err != nil {
+		return err
+	}
+	return c.writeRecords(enc)
+}
+
+// writeRecords writes the items from the least recently used one.
+func (c *LRU[K, V]) writeRecords(enc Encoder) error {
+	for ele := c.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*lruEntry[K, V])
+		if err := enc.Encode(&snapshotRecord[K, V]{Key: kv.Key, Value: kv.Value}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *LRU[K, V]) restoreRecord(_ *snapshotHeader, _ int, rec *snapshotRecord[K, V]) {
+	c.add(rec.Key, rec.Value)
+}
+
+func (c *LRU[K, V]) finishRestore(_ *snapshotHeader) {}
@@ -0,0 +1,173 @@
+package cache
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// MetricsSource is the part of a cache read by Metrics, it is implemented
+// by Cache, TTL, FIFO and ExpirableLRU. The capacity is exported if the
+// source has a Cap method as well.
+type MetricsSource interface {
+	// Len returns current cache size.
+	Len() int
+	// Stats returns the counters of cache.
+	Stats() Stats
+}
+
+// Metrics exports the counters of named caches in the Prometheus text
+// exposition format, it serves them as an http.Handler so the caches can
+// be scraped without depending on the Prometheus client library.
+// The sources must be safe to read while they are used, e.g. created by New.
+type Metrics struct {
+	namespace string
+
+	mu      sync.RWMutex
+	sources map[string]MetricsSource
+}
+
+// NewMetrics returns a new Metrics whose metric names are prefixed by
+// namespace, e.g. "cache".
+func NewMetrics(namespace string) *Metrics {
+	return &Metrics{
+		namespace: namespace,
+		sources:   make(map[string]MetricsSource),
+	}
+}
+
+// Register adds a cache exported under name, it fails if the name is taken.
+func (m *Metrics) Register(name string, src MetricsSource) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if _, ok := m.sources[name]; ok {
+		return fmt.Errorf("cache %q is already registered", name)
+	}
+	m.sources[name] = src
+	return nil
+}
+
+// Unregister removes the cache registered under name.
+func (m *Metrics) Unregister(name string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sources, name)
+}
+
+// metricSample is the value of a metric for a cache.
+type metricSample struct {
+	cache string
+	// reason is the label of eviction metrics, it is empty for the others.
+	reason string
+	value  string
+}
+
+type metricFamily struct {
+	name    string
+	help    string
+	typ     string
+	samples []metricSample
+}
+
+// collect reads the registered caches sorted by name.
+func (m *Metrics) collect() []*metricFamily {
+	m.mu.RLock()
+	names := make([]string, 0, len(m.sources))
+	for name := range m.sources {
+		names = append(names, name)
+	}
+	sources := make([]MetricsSource, len(names))
+	sort.Strings(names)
+	for i, name := range names {
+		sources[i] = m.sources[name]
+	}
+	m.mu.RUnlock()
+
+	items := &metricFamily{name: "items", help: "Number of items in cache.", typ: "gauge"}
+	capacity := &metricFamily{name: "capacity", help: "Maximum number of items in cache, 0 means no limit.", typ: "gauge"}
+	hits := &metricFamily{name: "hits_total", help: "Number of lookups which found the item.", typ: "counter"}
+	misses := &metricFamily{name: "misses_total", help: "Number of lookups which did not find the item.", typ: "counter"}
+	ratio := &metricFamily{name: "hit_ratio", help: "Ratio of hits to all lookups.", typ: "gauge"}
+	evictions := &metricFamily{name: "evictions_total", help: "Number of items left cache by reason.", typ: "counter"}
+
+	for i, src := range sources {
+		name := names[i]
+		stats := src.Stats()
+		items.samples = append(items.samples, metricSample{cache: name, value: fmt.Sprint(src.Len())})
+		if c, ok := src.(interface{ Cap() int }); ok {
+			capacity.samples = append(capacity.samples, metricSample{cache: name, value: fmt.Sprint(c.Cap())})
+		}
+		hits.samples = append(hits.samples, metricSample{cache: name, value: fmt.Sprint(stats.Hits)})
+		misses.samples = append(misses.samples, metricSample{cache: name, value: fmt.Sprint(stats.Misses)})
+		ratio.samples = append(ratio.samples, metricSample{cache: name, value: fmt.Sprint(stats.HitRatio())})
+		for _, e := range []struct {
+			reason EvictReason
+			value  uint64
+		}{
+			{EvictCapacity, stats.Evictions.Capacity},
+			{EvictExpired, stats.Evictions.Expired},
+			{EvictRemoved, stats.Evictions.Removed},
+			{EvictReplaced, stats.Evictions.Replaced},
+		} {
+			evictions.samples = append(evictions.samples, metricSample{cache: name, reason: e.reason.String(), value: fmt.Sprint(e.value)})
+		}
+	}
+	return []*metricFamily{items, capacity, hits, misses, ratio, evictions}
+}
+
+// WriteTo writes the metrics of all registered caches to w.
+func (m *Metrics) WriteTo(w io.Writer) (int64, error) {
+	cw := &countWriter{w: w}
+	bw := bufio.NewWriter(cw)
+	for _, f := range m.collect() {
+		if len(f.samples) == 0 {
+			continue
+		}
+		name := f.name
+		if m.namespace != "" {
+			name = m.namespace + "_" + name
+		}
+		fmt.Fprintf(bw, "# HELP %s %s\n", name, f.help)
+		fmt.Fprintf(bw, "# TYPE %s %s\n", name, f.typ)
+		for _, s := range f.samples {
+			fmt.Fprintf(bw, "%s{cache=\"%s\"", name, escapeLabelValue(s.cache))
+			if s.reason != "" {
+				fmt.Fprintf(bw, ",reason=\"%s\"", s.reason)
+			}
+			fmt.Fprintf(bw, "} %s\n", s.value)
+		}
+	}
+	err := bw.Flush()
+	return cw.n, err
+}
+
+// ServeHTTP writes the metrics in the Prometheus text format.
+func (m *Metrics) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	m.WriteTo(w)
+}
+
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// escapeLabelValue escapes a label value as required by the text format.
+func escapeLabelValue(v string) string {
+	return labelValueEscaper.Replace(v)
+}
+
+// countWriter counts the bytes written to w.
+type countWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	n, err := w.w.Write(p)
+	w.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,258 @@
+package cache
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+var (
+	// ErrUnknownCacheType is returned when creating a cache of unknown Type
+	ErrUnknownCacheType = errors.New("unknown cache type")
+	// ErrInvalidOption is returned when creating a cache with invalid size or options
+	ErrInvalidOption = errors.New("invalid cache option")
+)
+
+// Option configures the cache created by NewWithOptions, NewFIFOWithOptions
+// or NewTTLWithOptions. Each option records the caches it applies to, and
+// the constructors reject the options which do not apply to their cache.
+type Option func(s *settings) error
+
+// optionTarget is a set of caches an Option applies to.
+type optionTarget uint8
+
+const (
+	forLRU optionTarget = 1 << iota
+	forTwoQueue
+	forARC
+	forTinyLFU
+	forFIFO
+	forTTL
+
+	// forTypes is the caches created by NewWithOptions.
+	forTypes = forLRU | forTwoQueue | forARC | forTinyLFU
+)
+
+// typeTargets is the target of each Type accepted by NewWithOptions.
+var typeTargets = map[Type]optionTarget{
+	LRUCache:      forLRU,
+	TwoQueueCache: forTwoQueue,
+	ARCCache:      forARC,
+	TinyLFUCache:  forTinyLFU,
+}
+
+// appliedOption is an option set on settings, it is checked
+// against the cache to create.
+type appliedOption struct {
+	name    string
+	targets optionTarget
+}
+
+// newOption returns an Option named name which applies to targets only.
+func newOption(name string, targets optionTarget, apply func(s *settings) error) Option {
+	return func(s *settings) error {
+		if err := apply(s); err != nil {
+			return err
+		}
+		s.applied = append(s.applied, appliedOption{name: name, targets: targets})
+		return nil
+	}
+}
+
+// settings holds the options which are not bound to the key and value types.
+type settings struct {
+	applied []appliedOption
+
+	recentRatio *float64
+	ghostRatio  *float64
+	shards      int
+	dedup       bool
+	maxCost     int64
+	// cost is a CostFunc, it is checked against the value type
+	// when the cache is created.
+	cost        interface{}
+	staleGrace  *time.Duration
+	negativeTTL *time.Duration
+	// onEvict is an EvictCallback, it is checked against the cache types
+	// when the cache is created.
+	onEvict interface{}
+}
+
+// WithRecentRatio sets the ratio of a TwoQueueCache dedicated to recently
+// added entries that have only been accessed once. ratio must be in (0, 1).
+func WithRecentRatio(ratio float64) Option {
+	return newOption("recent ratio", forTwoQueue, func(s *settings) error {
+		if ratio <= 0 || ratio >= 1 {
+			return fmt.Errorf("%w: recent ratio %v is not in (0, 1)", ErrInvalidOption, ratio)
+		}
+		s.recentRatio = &ratio
+		return nil
+	})
+}
+
+// WithGhostRatio sets the ratio of ghost entries a TwoQueueCache keeps to
+// track entries recently evicted. ratio must be in [0, 1].
+func WithGhostRatio(ratio float64) Option {
+	return newOption("ghost ratio", forTwoQueue, func(s *settings) error {
+		if ratio < 0 || ratio > 1 {
+			return fmt.Errorf("%w: ghost ratio %v is not in [0, 1]", ErrInvalidOption, ratio)
+		}
+		s.ghostRatio = &ratio
+		return nil
+	})
+}
+
+// WithShards splits the cache into n independent caches selected by key
+// hash, see NewSharded.
+func WithShards(n int) Option {
+	return newOption("shards", forTypes, func(s *settings) error {
+		if n < 1 {
+			return fmt.Errorf("%w: shards %d is less than 1", ErrInvalidOption, n)
+		}
+		s.shards = n
+		return nil
+	})
+}
+
+// WithDedup makes a FIFO cache replace the value of an existing key
+// in place on Put, instead of appending a duplicate item.
+func WithDedup() Option {
+	return newOption("dedup", forFIFO, func(s *settings) error {
+		s.dedup = true
+		return nil
+	})
+}
+
+// WithStaleGrace keeps the items of a TTL cache for d after they expire,
+// so that TTL.Lookup can serve them as stale while they are refreshed.
+func WithStaleGrace(d time.Duration) Option {
+	return newOption("stale grace", forTTL, func(s *settings) error {
+		if d < 0 {
+			return fmt.Errorf("%w: stale grace %v is negative", ErrInvalidOption, d)
+		}
+		s.staleGrace = &d
+		return nil
+	})
+}
+
+// WithNegativeTTL sets the TTL of the negative entries put by
+// TTL.PutNegative, it is usually shorter than the TTL of values.
+func WithNegativeTTL(d time.Duration) Option {
+	return newOption("negative TTL", forTTL, func(s *settings) error {
+		if d <= 0 {
+			return fmt.Errorf("%w: negative TTL %v is not positive", ErrInvalidOption, d)
+		}
+		s.negativeTTL = &d
+		return nil
+	})
+}
+
+// WithCost bounds the cache by the total cost of items as well as by the
+// number of items, maxCost 0 means no limit. Each item costs 1 if cost is
+// nil, its value type must match the cache. Only LRUCache and
+// TwoQueueCache support cost.
+func WithCost[V any](maxCost int64, cost CostFunc[V]) Option {
+	return newOption("cost", forLRU|forTwoQueue, func(s *settings) error {
+		if maxCost < 0 {
+			return fmt.Errorf("%w: max cost %d is negative", ErrInvalidOption, maxCost)
+		}
+		s.maxCost = maxCost
+		s.cost = cost
+		return nil
+	})
+}
+
+// WithOnEvict sets the callback called whenever an item leaves the cache,
+// its key and value types must match the cache.
+func WithOnEvict[K comparable, V any](onEvict EvictCallback[K, V]) Option {
+	return newOption("onEvict", forTypes|forFIFO|forTTL, func(s *settings) error {
+		s.onEvict = onEvict
+		return nil
+	})
+}
+
+// NewWithOptions create Cache instance by CacheType and options.
+// Unlike New it returns an error on unknown cache type or invalid options.
+// size 0 means no limit for LRUCache and TwoQueueCache, ARCCache and
+// TinyLFUCache require a positive size.
+func NewWithOptions[K comparable, V any](size int, cacheType Type, opts ...Option) (Cache[K, V], error) {
+	target, ok := typeTargets[cacheType]
+	if !ok {
+		return nil, fmt.Errorf("%w: %d", ErrUnknownCacheType, cacheType)
+	}
+	if size < 0 {
+		return nil, fmt.Errorf("%w: size %d is negative", ErrInvalidOption, size)
+	}
+	// Only LRU and TwoQueue treat size 0 as no limit, ARC and TinyLFU
+	// adapt to the size so they need a bound.
+	if size == 0 && cacheType != LRUCache && cacheType != TwoQueueCache {
+		return nil, fmt.Errorf("%w: %v requires a positive size", ErrInvalidOption, cacheType)
+	}
+
+	s, err := applyOptions(opts, target, cacheType.String())
+	if err != nil {
+		return nil, err
+	}
+
+	o := newCacheOptions[K, V]()
+	if s.recentRatio != nil {
+		o.recentRatio = *s.recentRatio
+	}
+	if s.ghostRatio != nil {
+		o.ghostRatio = *s.ghostRatio
+	}
+	if s.cost != nil {
+		o.maxCost = s.maxCost
+		if o.cost, err = costFunc[V](s); err != nil {
+			return nil, err
+		}
+	}
+	if o.onEvict, err = evictCallback[K, V](s); err != nil {
+		return nil, err
+	}
+
+	if s.shards > 1 {
+		return newShardedCache[K, V](size, cacheType, s.shards, o), nil
+	}
+	return newThreadSafeCache[K, V](newRawCache[K, V](size, cacheType, o)), nil
+}
+
+// applyOptions applies opts to new settings, it fails if an option
+// does not apply to target, which is named kind in the error.
+func applyOptions(opts []Option, target optionTarget, kind string) (*settings, error) {
+	s := new(settings)
+	for _, opt := range opts {
+		if err := opt(s); err != nil {
+			return nil, err
+		}
+	}
+	for _, o := range s.applied {
+		if o.targets&target == 0 {
+			return nil, fmt.Errorf("%w: %s does not apply to %s", ErrInvalidOption, o.name, kind)
+		}
+	}
+	return s, nil
+}
+
+// costFunc returns the cost function set by WithCost,
+// it fails if the function does not match the value type.
+func costFunc[V any](s *settings) (CostFunc[V], error) {
+	cost, ok := s.cost.(CostFunc[V])
+	if !ok {
+		return nil, fmt.Errorf("%w: %T does not match the value type", ErrInvalidOption, s.cost)
+	}
+	return cost, nil
+}
+
+// evictCallback returns the callback set by WithOnEvict,
+// it fails if the callback does not match the cache types.
+func evictCallback[K comparable, V any](s *settings) (EvictCallback[K, V], error) {
+	if s.onEvict == nil {
+		return nil, nil
+	}
+	onEvict, ok := s.onEvict.(EvictCallback[K, V])
+	if !ok {
+		return nil, fmt.Errorf("%w: %T does not match the cache types", ErrInvalidOption, s.onEvict)
+	}
+	return onEvict, nil
+}
@@ -0,0 +1,361 @@
+package cache
+
+import (
+	"encoding/binary"
+	"hash/maphash"
+	"io"
+	"math"
+	"math/bits"
+	"reflect"
+)
+
+// shardedCache splits the key space into independent thread-safe caches
+// selected by key hash, so that operations on different shards do not
+// contend for the same lock.
+type shardedCache[K comparable, V any] struct {
+	seed   maphash.Seed
+	shards []*threadSafeCache[K, V]
+}
+
+// paddedShard keeps the locks of adjacent shards on different cache
+// lines, so that cores working on different shards do not contend.
+type paddedShard[K comparable, V any] struct {
+	threadSafeCache[K, V]
+	_ [64]byte
+}
+
+func newShardedCache[K comparable, V any](size int, cacheType Type, shards int, opts cacheOptions[K, V]) Cache[K, V] {
+	// A shard of size or cost 0 would have no limit,
+	// so there are no more shards than the limits.
+	if size > 0 && shards > size {
+		shards = size
+	}
+	if opts.maxCost > 0 && int64(shards) > opts.maxCost {
+		shards = int(opts.maxCost)
+	}
+
+	c := &shardedCache[K, V]{
+		seed:   maphash.MakeSeed(),
+		shards: make([]*threadSafeCache[K, V], shards),
+	}
+	maxCost := opts.maxCost
+	for i := range c.shards {
+		// Each shard gets an equal part of the limits, and the first
+		// shards one more for the remainder, so that the totals are
+		// the limits.
+		shardSize := size / shards
+		if i < size%shards {
+			shardSize++
+		}
+		opts.maxCost = maxCost / int64(shards)
+		if int64(i) < maxCost%int64(shards) {
+			opts.maxCost++
+		}
+		s := &paddedShard[K, V]{}
+		s.cache = newRawCache[K, V](shardSize, cacheType, opts)
+		c.shards[i] = &s.threadSafeCache
+	}
+	return c
+}
+
+// shard maps the hash to [0, len(shards)) by multiplication, which is
+// cheaper than modulo.
+func (c *shardedCache[K, V]) shard(key K) *threadSafeCache[K, V] {
+	i, _ := bits.Mul64(c.hash(key), uint64(len(c.shards)))
+	return c.shards[i]
+}
+
+func (c *shardedCache[K, V]) hash(key K) uint64 {
+	return hashKey(c.seed, key)
+}
+
+// hashKey avoids the generic maphash path for the most common key types.
+func hashKey[K comparable](seed maphash.Seed, key K) uint64 {
+	switch k := any(key).(type) {
+	case uint64:
+		return mix64(k)
+	case int64:
+		return mix64(uint64(k))
+	case int:
+		return mix64(uint64(k))
+	case string:
+		return maphash.String(seed, k)
+	default:
+		var h maphash.Hash
+		h.SetSeed(seed)
+		// The pointer keeps interface keys as interfaces.
+		writeHashValue(&h, reflect.ValueOf(&key).Elem())
+		return h.Sum64()
+	}
+}
+
+// writeHashValue writes v to h so that equal values write the same bytes,
+// it supports all comparable kinds.
+func writeHashValue(h *maphash.Hash, v reflect.Value) {
+	var buf [8]byte
+	writeUint64 := func(x uint64) {
+		binary.LittleEndian.PutUint64(buf[:], x)
+		h.Write(buf[:])
+	}
+	writeFloat := func(f float64) {
+		// -0 equals 0, so it must be hashed the same.
+		if f == 0 {
+			f = 0
+		}
+		writeUint64(math.Float64bits(f))
+	}
+
+	switch v.Kind() {
+	case reflect.Bool:
+		if v.Bool() {
+			h.WriteByte(1)
+		} else {
+			h.WriteByte(0)
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		writeUint64(uint64(v.Int()))
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		writeUint64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		writeFloat(v.Float())
+	case reflect.Complex64, reflect.Complex128:
+		writeFloat(real(v.Complex()))
+		writeFloat(imag(v.Complex()))
+	case reflect.String:
+		h.WriteString(v.String())
+	case reflect.Pointer, reflect.Chan, reflect.UnsafePointer:
+		writeUint64(uint64(v.Pointer()))
+	case reflect.Interface:
+		if v.IsNil() {
+			h.WriteByte(0)
+			return
+		}
+		// Values of different dynamic types are never equal.
+		h.WriteString(v.Elem().Type().String())
+		writeHashValue(h, v.Elem())
+	case reflect.Array:
+		for i := 0; i < v.Len(); i++ {
+			writeHashValue(h, v.Index(i))
+		}
+	case reflect.Struct:
+		for i := 0; i < v.NumField(); i++ {
+			writeHashValue(h, v.Field(i))
+		}
+	}
+}
+
+// mix64 is the finalizer of splitmix64, it spreads sequential
+// integer keys evenly over the shards.
+func mix64(x uint64) uint64 {
+	x ^= x >> 30
+	x *= 0xbf58476d1ce4e5b9
+	x ^= x >> 27
+	x *= 0x94d049bb133111eb
+	x ^= x >> 31
+	return x
+}
+
+// Put puts an item into cache.
+func (c *shardedCache[K, V]) Put(key K, value V) {
+	c.shard(key).Put(key, value)
+}
+
+// Get retrives an item from cache.
+func (c *shardedCache[K, V]) Get(key K) (V, bool) {
+	return c.shard(key).Get(key)
+}
+
+// Peek reads an item from cache. The action is no considered 'Use'.
+func (c *shardedCache[K, V]) Peek(key K) (V, bool) {
+	return c.shard(key).Peek(key)
+}
+
+// Remove eliminates an item from cache.
+func (c *shardedCache[K, V]) Remove(key K) {
+	c.shard(key).Remove(key)
+}
+
+// Elems return all items in cache.
+// Items are grouped by shard, so the order is only meaningful within a shard.
+func (c *shardedCache[K, V]) Elems() []*Item[K, V] {
+	var elems []*Item[K, V]
+	for _, s := range c.shards {
+		elems = append(elems, s.Elems()...)
+	}
+	return elems
+}
+
+// Range calls f for each item in cache until f returns false,
+// a shard is locked only while its items are visited.
+func (c *shardedCache[K, V]) Range(f func(key K, value V) bool) {
+	for _, s := range c.shards {
+		more := true
+		s.Range(func(key K, value V) bool {
+			more = f(key, value)
+			return more
+		})
+		if !more {
+			return
+		}
+	}
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *shardedCache[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.RemoveIf(f)
+	}
+	return n
+}
+
+// Keys returns the keys of all items in cache.
+func (c *shardedCache[K, V]) Keys() []K {
+	var keys []K
+	for _, s := range c.shards {
+		keys = append(keys, s.Keys()...)
+	}
+	return keys
+}
+
+// Purge eliminates all items from cache.
+func (c *shardedCache[K, V]) Purge() {
+	for _, s := range c.shards {
+		s.Purge()
+	}
+}
+
+// Len returns current cache size
+func (c *shardedCache[K, V]) Len() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Len()
+	}
+	return n
+}
+
+// Cost returns the total cost of items in cache
+func (c *shardedCache[K, V]) Cost() int64 {
+	var cost int64
+	for _, s := range c.shards {
+		cost += s.Cost()
+	}
+	return cost
+}
+
+// Cap returns the maximum number of items summed over all shards.
+func (c *shardedCache[K, V]) Cap() int {
+	n := 0
+	for _, s := range c.shards {
+		n += s.Cap()
+	}
+	return n
+}
+
+// Stats returns the counters of cache summed over all shards.
+func (c *shardedCache[K, V]) Stats() Stats {
+	var stats Stats
+	for _, s := range c.shards {
+		stats = stats.add(s.Stats())
+	}
+	return stats
+}
+
+// Snapshot writes all items in cache to w, shard by shard.
+func (c *shardedCache[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	enc := codec.NewEncoder(w)
+	if err := writeSnapshotHeader(enc, shardedSnapshot, 0, len(c.shards)); err != nil {
+		return err
+	}
+	for _, s := range c.shards {
+		s.lock.RLock()
+		err := s.raw().snapshot(enc)
+		s.lock.RUnlock()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads a snapshot from r into an empty cache. The hash seed is
+// different in every process, so items are routed to shards by key again
+// and the number of shards may differ from the snapshot.
+func (c *shardedCache[K, V]) Restore(r io.Reader, codec Codec) error {
+	// All shards are locked before the check, so that no item is put
+	// between the check and the restore.
+	for _, s := range c.shards {
+		s.lock.Lock()
+	}
+	var (
+		h       *snapshotHeader
+		headers []*snapshotHeader
+	)
+	defer func() {
+		for i, s := range c.shards {
+			if h != nil {
+				s.raw().finishRestore(c.restoreHeader(headers, i))
+			}
+			s.lock.Unlock()
+		}
+	}()
+
+	for _, s := range c.shards {
+		if s.cache.Len() != 0 {
+			return ErrRestoreNotEmpty
+		}
+	}
+	dec := codec.NewDecoder(r)
+	h, err := readSnapshotHeader(dec, shardedSnapshot)
+	if err != nil {
+		return err
+	}
+	kind := c.shards[0].raw().snapshotKind()
+
+	for _, n := range h.Sections {
+		for i := 0; i < n; i++ {
+			sh, err := readSnapshotHeader(dec, kind)
+			if err != nil {
+				return err
+			}
+			headers = append(headers, sh)
+			err = readSnapshotRecords(dec, sh, func(section int, rec *snapshotRecord[K, V]) {
+				c.shard(rec.Key).raw().restoreRecord(sh, section, rec)
+			})
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// restoreHeader returns the header which finishes the restore of shard i
+// from the headers of the shards in the snapshot. A shard keeps the header
+// of its own if the number of shards is unchanged, otherwise the shards
+// share the learned target size of ARC equally.
+func (c *shardedCache[K, V]) restoreHeader(headers []*snapshotHeader, i int) *snapshotHeader {
+	if len(headers) == len(c.shards) {
+		return headers[i]
+	}
+	p := 0
+	for _, h := range headers {
+		p += h.P
+	}
+	return &snapshotHeader{P: p / len(c.shards)}
+}
+
+// NewSharded create Cache instance by CacheType which is split into shards
+// independent caches, each one holding about size/shards items.
+// A shards value less than 2 is the same as New.
+//
+// Sharding only pays off when goroutines on many cores contend for the
+// lock, otherwise hashing the key makes each operation a little slower.
+// The gain is the largest for LRUCache, whose operations are short, and
+// a TwoQueueCache may be no faster than a single lock.
+func NewSharded[K comparable, V any](size int, cacheType Type, shards int) Cache[K, V] {
+	if shards < 2 {
+		return New[K, V](size, cacheType)
+	}
+	return mustCache(NewWithOptions[K, V](size, cacheType, WithShards(shards)))
+}
@@ -0,0 +1,90 @@
+package cache
+
+const (
+	// cmDepth is the number of rows of cmSketch.
+	cmDepth = 4
+	// cmCountersPerItem is the number of counters of each row
+	// per cache item, it keeps the collisions rare.
+	cmCountersPerItem = 16
+	// cmResetFactor is the number of increments per cache item
+	// after which all counters are halved.
+	cmResetFactor = 10
+)
+
+// cmSketch is a count-min sketch with 4-bit counters, 16 counters are
+// packed into a uint64. It estimates how often a key was accessed
+// recently using a small, fixed amount of memory.
+type cmSketch struct {
+	rows [cmDepth][]uint64
+	// mask selects a counter within a row.
+	mask uint64
+
+	// additions is the number of increments since the last reset,
+	// counters are halved when it reaches sampleSize so that old
+	// accesses are forgotten over time.
+	additions  int
+	sampleSize int
+}
+
+func newCMSketch(size int) *cmSketch {
+	items := uint64(1)
+	for items < uint64(size) {
+		items <<= 1
+	}
+	counters := items * cmCountersPerItem
+
+	s := &cmSketch{
+		mask:       counters - 1,
+		sampleSize: cmResetFactor * int(items),
+	}
+	for i := range s.rows {
+		s.rows[i] = make([]uint64, counters/16)
+	}
+	return s
+}
+
+// index returns the counter of hash in row i.
+func (s *cmSketch) index(hash uint64, i int) uint64 {
+	h1, h2 := hash&0xffffffff, hash>>32
+	return (h1 + uint64(i)*h2) & s.mask
+}
+
+// increment only increments the smallest counters of hash, which is known
+// as conservative update and reduces the overestimation by collisions.
+func (s *cmSketch) increment(hash uint64) {
+	min := s.estimate(hash)
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		word, shift := idx/16, (idx%16)*4
+		if v := uint8((s.rows[i][word] >> shift) & 0xf); v == min && v < 0xf {
+			s.rows[i][word] += 1 << shift
+		}
+	}
+
+	s.additions++
+	if s.additions >= s.sampleSize {
+		s.reset()
+	}
+}
+
+func (s *cmSketch) estimate(hash uint64) uint8 {
+	min := uint8(0xf)
+	for i := range s.rows {
+		idx := s.index(hash, i)
+		word, shift := idx/16, (idx%16)*4
+		if v := uint8((s.rows[i][word] >> shift) & 0xf); v < min {
+			min = v
+		}
+	}
+	return min
+}
+
+// reset halves all counters.
+func (s *cmSketch) reset() {
+	for _, row := range s.rows {
+		for j := range row {
+			row[j] = (row[j] >> 1) & 0x7777777777777777
+		}
+	}
+	s.additions /= 2
+}
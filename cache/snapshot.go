@@ -0,0 +1,163 @@
+package cache
+
+import (
+	"encoding/gob"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// Encoder writes values to a snapshot stream.
+type Encoder interface {
+	Encode(v interface{}) error
+}
+
+// Decoder reads values from a snapshot stream.
+type Decoder interface {
+	Decode(v interface{}) error
+}
+
+// Codec creates the encoder and decoder of snapshot streams,
+// keys and values of cache must be supported by the codec.
+type Codec interface {
+	NewEncoder(w io.Writer) Encoder
+	NewDecoder(r io.Reader) Decoder
+}
+
+type gobCodec struct{}
+
+func (gobCodec) NewEncoder(w io.Writer) Encoder {
+	return gob.NewEncoder(w)
+}
+
+func (gobCodec) NewDecoder(r io.Reader) Decoder {
+	return gob.NewDecoder(r)
+}
+
+type jsonCodec struct{}
+
+func (jsonCodec) NewEncoder(w io.Writer) Encoder {
+	return json.NewEncoder(w)
+}
+
+func (jsonCodec) NewDecoder(r io.Reader) Decoder {
+	return json.NewDecoder(r)
+}
+
+var (
+	// GobCodec encodes snapshots with encoding/gob,
+	// concrete types stored in interface values must be registered by gob.Register.
+	GobCodec Codec = gobCodec{}
+	// JSONCodec encodes snapshots as a stream of JSON values.
+	JSONCodec Codec = jsonCodec{}
+)
+
+var (
+	// ErrRestoreNotEmpty is returned when restoring a snapshot into a cache which has items
+	ErrRestoreNotEmpty = errors.New("restore into non-empty cache")
+)
+
+// Snapshotter is implemented by caches which can be saved and restored,
+// e.g. to warm up the cache after restart.
+type Snapshotter interface {
+	// Snapshot writes all items in cache to w.
+	Snapshot(w io.Writer, codec Codec) error
+	// Restore reads a snapshot from r into an empty cache.
+	Restore(r io.Reader, codec Codec) error
+}
+
+const snapshotVersion = 1
+
+// Snapshot kinds, a snapshot can only be restored into a cache of the same kind.
+const (
+	lruSnapshot          = "lru"
+	twoQueueSnapshot     = "2q"
+	arcSnapshot          = "arc"
+	tinyLFUSnapshot      = "tinylfu"
+	ttlSnapshot          = "ttl"
+	expirableLRUSnapshot = "expirable-lru"
+	shardedSnapshot      = "sharded"
+)
+
+// snapshotHeader is the first value of a snapshot stream.
+type snapshotHeader struct {
+	Version int
+	Kind    string
+	// Sections is the number of records of each section, e.g. the lists
+	// of TwoQueue. Records of a section are written oldest first.
+	Sections []int
+	// P is the adaptive target size of ARC.
+	P int
+}
+
+// snapshotRecord is an item of a snapshot stream.
+type snapshotRecord[K comparable, V any] struct {
+	Key   K
+	Value V
+	// TTL is the remaining time to live of the item, if it expires.
+	TTL time.Duration
+}
+
+// rawSnapshotter is implemented by the caches which are not thread-safe,
+// restoring record by record lets shardedCache route records to shards.
+type rawSnapshotter[K comparable, V any] interface {
+	Len() int
+	snapshotKind() string
+	snapshot(enc Encoder) error
+	restoreRecord(h *snapshotHeader, section int, rec *snapshotRecord[K, V])
+	finishRestore(h *snapshotHeader)
+}
+
+func writeSnapshotHeader(enc Encoder, kind string, p int, sections ...int) error {
+	return enc.Encode(&snapshotHeader{
+		Version:  snapshotVersion,
+		Kind:     kind,
+		Sections: sections,
+		P:        p,
+	})
+}
+
+func readSnapshotHeader(dec Decoder, kind string) (*snapshotHeader, error) {
+	h := new(snapshotHeader)
+	if err := dec.Decode(h); err != nil {
+		return nil, err
+	}
+	if h.Version != snapshotVersion {
+		return nil, fmt.Errorf("unsupported snapshot version %d", h.Version)
+	}
+	if h.Kind != kind {
+		return nil, fmt.Errorf("can not restore %s snapshot into %s cache", h.Kind, kind)
+	}
+	return h, nil
+}
+
+func readSnapshotRecords[K comparable, V any](dec Decoder, h *snapshotHeader, fn func(section int, rec *snapshotRecord[K, V])) error {
+	for section, n := range h.Sections {
+		for i := 0; i < n; i++ {
+			rec := new(snapshotRecord[K, V])
+			if err := dec.Decode(rec); err != nil {
+				return err
+			}
+			fn(section, rec)
+		}
+	}
+	return nil
+}
+
+func restoreSnapshot[K comparable, V any](c rawSnapshotter[K, V], dec Decoder) error {
+	if c.Len() != 0 {
+		return ErrRestoreNotEmpty
+	}
+	h, err := readSnapshotHeader(dec, c.snapshotKind())
+	if err != nil {
+		return err
+	}
+	err = readSnapshotRecords(dec, h, func(section int, rec *snapshotRecord[K, V]) {
+		c.restoreRecord(h, section, rec)
+	})
+	// Keep what has been restored consistent even on error.
+	c.finishRestore(h)
+	return err
+}
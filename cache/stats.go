@@ -0,0 +1,132 @@
+package cache
+
+import (
+	"sync/atomic"
+)
+
+// Stats is a snapshot of cache counters.
+type Stats struct {
+	// Hits is the number of Get calls which found the item.
+	Hits uint64
+	// Misses is the number of Get calls which did not find the item.
+	Misses uint64
+	// Puts is the number of Put calls.
+	Puts uint64
+	// Evictions is the number of items left the cache by reason.
+	Evictions EvictionStats
+	// GhostHits is the number of Put calls for keys which were recently
+	// evicted and are still tracked by a ghost list (TwoQueue and ARC).
+	GhostHits uint64
+}
+
+// EvictionStats is the number of evicted items by EvictReason.
+type EvictionStats struct {
+	Capacity uint64
+	Expired  uint64
+	Removed  uint64
+	Replaced uint64
+}
+
+// Total returns the number of evicted items for all reasons.
+func (s EvictionStats) Total() uint64 {
+	return s.Capacity + s.Expired + s.Removed + s.Replaced
+}
+
+// HitRatio returns the ratio of hits to all Get calls.
+func (s Stats) HitRatio() float64 {
+	total := s.Hits + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits) / float64(total)
+}
+
+func (s Stats) add(o Stats) Stats {
+	s.Hits += o.Hits
+	s.Misses += o.Misses
+	s.Puts += o.Puts
+	s.GhostHits += o.GhostHits
+	s.Evictions.Capacity += o.Evictions.Capacity
+	s.Evictions.Expired += o.Evictions.Expired
+	s.Evictions.Removed += o.Evictions.Removed
+	s.Evictions.Replaced += o.Evictions.Replaced
+	return s
+}
+
+// statsCounter holds the counters of a cache. The counters are atomic so
+// Stats never has to take the cache lock. All methods are no-op on a nil
+// statsCounter, which is used by lists internal to another cache.
+type statsCounter struct {
+	hits      atomic.Uint64
+	misses    atomic.Uint64
+	puts      atomic.Uint64
+	ghostHits atomic.Uint64
+	evictions [EvictReplaced + 1]atomic.Uint64
+}
+
+func newStatsCounter() *statsCounter {
+	return &statsCounter{}
+}
+
+func (s *statsCounter) hit() {
+	if s != nil {
+		s.hits.Add(1)
+	}
+}
+
+func (s *statsCounter) miss() {
+	if s != nil {
+		s.misses.Add(1)
+	}
+}
+
+// revive:disable-next-line:flag-parameter
+func (s *statsCounter) lookup(ok bool) {
+	if ok {
+		s.hit()
+	} else {
+		s.miss()
+	}
+}
+
+func (s *statsCounter) put() {
+	if s != nil {
+		s.puts.Add(1)
+	}
+}
+
+func (s *statsCounter) ghostHit() {
+	if s != nil {
+		s.ghostHits.Add(1)
+	}
+}
+
+func (s *statsCounter) snapshot() Stats {
+	if s == nil {
+		return Stats{}
+	}
+	return Stats{
+		Hits:      s.hits.Load(),
+		Misses:    s.misses.Load(),
+		Puts:      s.puts.Load(),
+		GhostHits: s.ghostHits.Load(),
+		Evictions: EvictionStats{
+			Capacity: s.evictions[EvictCapacity].Load(),
+			Expired:  s.evictions[EvictExpired].Load(),
+			Removed:  s.evictions[EvictRemoved].Load(),
+			Replaced: s.evictions[EvictReplaced].Load(),
+		},
+	}
+}
+
+// countEvictions returns an EvictCallback which counts the eviction in s
+// before calling f.
+func countEvictions[K comparable, V any](s *statsCounter, f EvictCallback[K, V]) EvictCallback[K, V] {
+	if s == nil {
+		return f
+	}
+	return func(key K, value V, reason EvictReason) {
+		s.evictions[reason].Add(1)
+		f.call(key, value, reason)
+	}
+}
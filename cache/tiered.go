@@ -0,0 +1,280 @@
+package cache
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// Store is a shared cache used as L2 by TieredCache, e.g. Redis.
+// A ttl of 0 means the value never expires.
+type Store interface {
+	// Get returns the value of key and its expire time, which is zero if
+	// it never expires. ok is false if the key does not exist.
+	Get(ctx context.Context, key string) (value []byte, expire time.Time, ok bool, err error)
+	// Set sets the value of key which expires after ttl.
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	// Delete removes key, it is not an error if the key does not exist.
+	Delete(ctx context.Context, key string) error
+}
+
+// ExpiringCache is a Cache whose items expire, e.g. ExpirableLRU or TTL.
+type ExpiringCache[K comparable, V any] interface {
+	Cache[K, V]
+	// PutWithTTL puts an item into cache which expires after ttl.
+	PutWithTTL(key K, value V, ttl time.Duration)
+}
+
+// tieredPruneMin is the least number of deadlines kept before they are pruned.
+const tieredPruneMin = 64
+
+// TieredCache is a two level cache. L1 is an in-process cache, e.g.
+// ExpirableLRU, and L2 is a Store shared by processes. Get populates L1
+// on an L2 hit, and Put writes through to both levels. An item expires
+// from L1 when it expires from L2, so L1 never serves a value L2 has
+// dropped. Items which never expire from L2 use the TTL of L1, if any.
+type TieredCache[K comparable, V any] struct {
+	l1 Cache[K, V]
+	// expiring is l1 if it is an ExpiringCache.
+	expiring ExpiringCache[K, V]
+	l2       Store
+	codec    Codec
+	key      func(key K) string
+	ttl      time.Duration
+
+	// mu guards deadlines, which keeps the expire time of the items put
+	// into l1 if it is not an ExpiringCache. Deadlines of the items which
+	// left l1 are pruned once there are pruneAt deadlines.
+	mu        sync.Mutex
+	deadlines map[K]time.Time
+	pruneAt   int
+}
+
+// NewTieredCache returns a TieredCache over l1 and l2, l1 must be
+// thread-safe, e.g. created by New or NewExpirableLRU. If l1 is an
+// ExpiringCache items expire from it with L2, otherwise TieredCache keeps
+// their expire time and drops them from l1 on a hit after it. Values are
+// encoded by codec in l2, and keys are converted by keyFunc, or fmt.Sprint
+// if it is nil. Values put into l2 expire after ttl, 0 means no expiry.
+func NewTieredCache[K comparable, V any](l1 Cache[K, V], l2 Store, codec Codec, keyFunc func(key K) string, ttl time.Duration) *TieredCache[K, V] {
+	if keyFunc == nil {
+		keyFunc = func(key K) string {
+			return fmt.Sprint(key)
+		}
+	}
+	c := &TieredCache[K, V]{
+		l1:    l1,
+		l2:    l2,
+		codec: codec,
+		key:   keyFunc,
+		ttl:   ttl,
+	}
+	if expiring, ok := l1.(ExpiringCache[K, V]); ok {
+		c.expiring = expiring
+	} else {
+		c.deadlines = make(map[K]time.Time)
+		c.pruneAt = tieredPruneMin
+	}
+	return c
+}
+
+// Get retrives an item from L1, or from L2 on a L1 miss.
+func (c *TieredCache[K, V]) Get(ctx context.Context, key K) (V, bool, error) {
+	if val, ok := c.getL1(key); ok {
+		return val, true, nil
+	}
+
+	var val V
+	data, expire, ok, err := c.l2.Get(ctx, c.key(key))
+	if err != nil || !ok {
+		return val, false, err
+	}
+	if err = c.codec.NewDecoder(bytes.NewReader(data)).Decode(&val); err != nil {
+		return val, false, err
+	}
+	if expire.IsZero() {
+		c.putL1(key, val, 0)
+	} else if ttl := time.Until(expire); ttl > 0 {
+		c.putL1(key, val, ttl)
+	}
+	return val, true, nil
+}
+
+// Put puts an item into both levels.
+func (c *TieredCache[K, V]) Put(ctx context.Context, key K, value V) error {
+	return c.PutWithTTL(ctx, key, value, c.ttl)
+}
+
+// PutWithTTL puts an item into both levels, it expires after ttl.
+// If L2 fails the item is removed from L1 as well, so that L1 does not
+// keep a value the other processes can not see.
+func (c *TieredCache[K, V]) PutWithTTL(ctx context.Context, key K, value V, ttl time.Duration) error {
+	var buf bytes.Buffer
+	if err := c.codec.NewEncoder(&buf).Encode(value); err != nil {
+		return err
+	}
+	if err := c.l2.Set(ctx, c.key(key), buf.Bytes(), ttl); err != nil {
+		c.removeL1(key)
+		return err
+	}
+	c.putL1(key, value, ttl)
+	return nil
+}
+
+// Remove eliminates an item from both levels.
+func (c *TieredCache[K, V]) Remove(ctx context.Context, key K) error {
+	c.removeL1(key)
+	return c.l2.Delete(ctx, c.key(key))
+}
+
+// L1 returns the in-process cache, e.g. to register it on an InvalidationBus.
+func (c *TieredCache[K, V]) L1() Cache[K, V] {
+	return c.l1
+}
+
+// getL1 retrives an item from L1 which has not expired.
+func (c *TieredCache[K, V]) getL1(key K) (V, bool) {
+	val, ok := c.l1.Get(key)
+	if !ok || c.expiring != nil {
+		return val, ok
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if deadline, ok := c.deadlines[key]; ok && !time.Now().Before(deadline) {
+		delete(c.deadlines, key)
+		c.l1.Remove(key)
+		var zero V
+		return zero, false
+	}
+	return val, true
+}
+
+// putL1 puts an item into L1 which expires after ttl, 0 means it never
+// expires unless L1 expires it.
+func (c *TieredCache[K, V]) putL1(key K, value V, ttl time.Duration) {
+	if c.expiring != nil {
+		if ttl > 0 {
+			c.expiring.PutWithTTL(key, value, ttl)
+		} else {
+			c.expiring.Put(key, value)
+		}
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if ttl > 0 {
+		c.deadlines[key] = time.Now().Add(ttl)
+		c.pruneDeadlines()
+	} else {
+		delete(c.deadlines, key)
+	}
+	c.l1.Put(key, value)
+}
+
+func (c *TieredCache[K, V]) removeL1(key K) {
+	if c.expiring != nil {
+		c.expiring.Remove(key)
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	delete(c.deadlines, key)
+	c.l1.Remove(key)
+}
+
+// pruneDeadlines drops the deadlines of the items which have expired or
+// have been evicted from L1, once there are pruneAt deadlines.
+func (c *TieredCache[K, V]) pruneDeadlines() {
+	if len(c.deadlines) < c.pruneAt {
+		return
+	}
+	now := time.Now()
+	for key, deadline := range c.deadlines {
+		if !now.Before(deadline) {
+			delete(c.deadlines, key)
+			c.l1.Remove(key)
+		} else if _, ok := c.l1.Peek(key); !ok {
+			delete(c.deadlines, key)
+		}
+	}
+	c.pruneAt = 2*len(c.deadlines) + tieredPruneMin
+}
+
+type memoryStoreItem struct {
+	value []byte
+	// expire is zero if the item never expires.
+	expire time.Time
+}
+
+// MemoryStore is a Store in memory, it is used to test TieredCache
+// in a single process. Expired items are removed when read.
+type MemoryStore struct {
+	mu    sync.Mutex
+	items map[string]memoryStoreItem
+}
+
+// NewMemoryStore returns a new MemoryStore.
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		items: make(map[string]memoryStoreItem),
+	}
+}
+
+// Get returns the value of key and its expire time.
+func (s *MemoryStore) Get(ctx context.Context, key string) ([]byte, time.Time, bool, error) {
+	if err := ctx.Err(); err != nil {
+		return nil, time.Time{}, false, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	item, ok := s.items[key]
+	if !ok {
+		return nil, time.Time{}, false, nil
+	}
+	if !item.expire.IsZero() && item.expire.Before(time.Now()) {
+		delete(s.items, key)
+		return nil, time.Time{}, false, nil
+	}
+	return append([]byte(nil), item.value...), item.expire, true, nil
+}
+
+// Set sets the value of key which expires after ttl.
+func (s *MemoryStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	item := memoryStoreItem{value: append([]byte(nil), value...)}
+	if ttl > 0 {
+		item.expire = time.Now().Add(ttl)
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.items[key] = item
+	return nil
+}
+
+// Delete removes key.
+func (s *MemoryStore) Delete(ctx context.Context, key string) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.items, key)
+	return nil
+}
@@ -0,0 +1,312 @@
+package cache
+
+import (
+	"hash/maphash"
+	"io"
+)
+
+const (
+	// defaultWindowRatio is the ratio of the W-TinyLFU cache dedicated
+	// to the window LRU which admits every new entry.
+	defaultWindowRatio float64 = 0.01
+
+	// defaultProtectedRatio is the ratio of the main cache dedicated
+	// to entries that have been accessed more than once.
+	defaultProtectedRatio float64 = 0.80
+)
+
+// TinyLFU is a fixed size W-TinyLFU cache.
+// New entries go into a small window LRU. Entries evicted from the window
+// compete with the least recently used entry of the main segmented LRU,
+// and only the one accessed more often according to a count-min sketch is
+// kept. This keeps a scan or a burst of one-time keys from flushing the
+// frequently used entries. The sketch is aged periodically so that
+// entries which were popular long ago can be evicted.
+// W-TinyLFU is described in https://arxiv.org/abs/1512.00727
+type TinyLFU[K comparable, V any] struct {
+	size          int
+	windowSize    int
+	mainSize      int
+	protectedSize int
+
+	// window admits every new entry.
+	window *LRU[K, V]
+	// probation holds the main entries which were accessed once
+	// since they left the window.
+	probation *LRU[K, V]
+	// protected holds the main entries which were accessed more than once.
+	protected *LRU[K, V]
+
+	seed   maphash.Seed
+	sketch *cmSketch
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+}
+
+// newTypedTinyLFU returns a TinyLFU of size items, size must be positive as
+// the window takes at least one item, NewWithOptions rejects size 0.
+func newTypedTinyLFU[K comparable, V any](size int, onEvict EvictCallback[K, V]) *TinyLFU[K, V] {
+	windowSize := int(float64(size) * defaultWindowRatio)
+	if windowSize < 1 {
+		windowSize = 1
+	}
+	mainSize := size - windowSize
+	if mainSize < 0 {
+		mainSize = 0
+	}
+	stats := newStatsCounter()
+
+	return &TinyLFU[K, V]{
+		size:          size,
+		windowSize:    windowSize,
+		mainSize:      mainSize,
+		protectedSize: int(float64(mainSize) * defaultProtectedRatio),
+		window:        newListLRU[K, V](0),
+		probation:     newListLRU[K, V](0),
+		protected:     newListLRU[K, V](0),
+		seed:          maphash.MakeSeed(),
+		sketch:        newCMSketch(size),
+		onEvict:       countEvictions(stats, onEvict),
+		stats:         stats,
+	}
+}
+
+// Put puts an item into cache.
+func (c *TinyLFU[K, V]) Put(key K, value V) {
+	c.stats.put()
+	c.sketch.increment(hashKey(c.seed, key))
+
+	// Check if value is in window or protected list,
+	// then just update it
+	if old, ok := c.window.Peek(key); ok {
+		c.window.add(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
+		return
+	}
+	if old, ok := c.protected.Peek(key); ok {
+		c.protected.add(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
+		return
+	}
+
+	// Check if value is in probation list,
+	// then move it to protected list
+	if old, ok := c.probation.take(key); ok {
+		c.protected.add(key, value)
+		c.demote()
+		c.onEvict.call(key, old, EvictReplaced)
+		return
+	}
+
+	// Put it to window list
+	c.window.add(key, value)
+	c.evictWindow()
+}
+
+// evictWindow moves the items over the window size to the main cache
+// if they are admitted.
+func (c *TinyLFU[K, V]) evictWindow() {
+	for c.window.Len() > c.windowSize {
+		k, v, _ := c.window.getAndRemoveOldest()
+		c.admit(k, v)
+	}
+}
+
+// admit puts a candidate into the main cache if it has room, otherwise
+// the candidate and the oldest main item compete by access frequency.
+func (c *TinyLFU[K, V]) admit(key K, value V) {
+	if c.probation.Len()+c.protected.Len() < c.mainSize {
+		c.probation.add(key, value)
+		return
+	}
+
+	victims := c.probation
+	if victims.Len() == 0 {
+		victims = c.protected
+	}
+	vk, _, ok := victims.oldest()
+	if !ok || c.sketch.estimate(hashKey(c.seed, key)) <= c.sketch.estimate(hashKey(c.seed, vk)) {
+		c.onEvict.call(key, value, EvictCapacity)
+		return
+	}
+
+	vk, vv, _ := victims.getAndRemoveOldest()
+	c.onEvict.call(vk, vv, EvictCapacity)
+	c.probation.add(key, value)
+}
+
+// demote moves the items over the protected size back to probation list.
+func (c *TinyLFU[K, V]) demote() {
+	for c.protected.Len() > c.protectedSize {
+		k, v, _ := c.protected.getAndRemoveOldest()
+		c.probation.add(k, v)
+	}
+}
+
+// Get retrives an item from cache.
+func (c *TinyLFU[K, V]) Get(key K) (V, bool) {
+	c.sketch.increment(hashKey(c.seed, key))
+
+	if val, ok := c.window.Get(key); ok {
+		c.stats.hit()
+		return val, ok
+	}
+	if val, ok := c.protected.Get(key); ok {
+		c.stats.hit()
+		return val, ok
+	}
+
+	// If in probation list, move it to protected list
+	if val, ok := c.probation.take(key); ok {
+		c.stats.hit()
+		c.protected.add(key, val)
+		c.demote()
+		return val, ok
+	}
+
+	c.stats.miss()
+	var zero V
+	return zero, false
+}
+
+// Peek reads an item from cache. The action is no considered 'Use'.
+func (c *TinyLFU[K, V]) Peek(key K) (V, bool) {
+	if val, ok := c.window.Peek(key); ok {
+		return val, ok
+	}
+	if val, ok := c.protected.Peek(key); ok {
+		return val, ok
+	}
+	return c.probation.Peek(key)
+}
+
+// Remove eliminates an item from cache.
+func (c *TinyLFU[K, V]) Remove(key K) {
+	for _, l := range []*LRU[K, V]{c.window, c.probation, c.protected} {
+		if val, ok := l.take(key); ok {
+			c.onEvict.call(key, val, EvictRemoved)
+			return
+		}
+	}
+}
+
+// Elems return all items in cache.
+func (c *TinyLFU[K, V]) Elems() []*Item[K, V] {
+	size := c.Len()
+	elems := make([]*Item[K, V], 0, size)
+	elems = append(elems, c.window.Elems()...)
+	elems = append(elems, c.probation.Elems()...)
+	elems = append(elems, c.protected.Elems()...)
+	return elems
+}
+
+// Range calls f for each item in cache until f returns false.
+func (c *TinyLFU[K, V]) Range(f func(key K, value V) bool) {
+	for _, l := range []*LRU[K, V]{c.window, c.probation, c.protected} {
+		if !l.rangeItems(f) {
+			return
+		}
+	}
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *TinyLFU[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	n := 0
+	for _, l := range []*LRU[K, V]{c.window, c.probation, c.protected} {
+		n += l.removeIf(f, c.onEvict)
+	}
+	return n
+}
+
+// Keys returns the keys of all items in cache.
+func (c *TinyLFU[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	for _, l := range []*LRU[K, V]{c.window, c.probation, c.protected} {
+		keys = l.appendKeys(keys)
+	}
+	return keys
+}
+
+// Purge eliminates all items from cache, the access frequencies are forgotten as well.
+func (c *TinyLFU[K, V]) Purge() {
+	c.RemoveIf(always[K, V])
+	c.sketch = newCMSketch(c.size)
+}
+
+// Len returns current cache size.
+func (c *TinyLFU[K, V]) Len() int {
+	return c.window.Len() + c.probation.Len() + c.protected.Len()
+}
+
+// Cost returns the total cost of items in cache,
+// TinyLFU does not support cost so each item costs 1.
+func (c *TinyLFU[K, V]) Cost() int64 {
+	return c.window.Cost() + c.probation.Cost() + c.protected.Cost()
+}
+
+// Cap returns the maximum number of items.
+func (c *TinyLFU[K, V]) Cap() int {
+	return c.size
+}
+
+// Stats returns the counters of cache.
+func (c *TinyLFU[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Snapshot writes all items in cache to w, the window, probation and
+// protected lists are kept. The frequency sketch is not saved.
+func (c *TinyLFU[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	return c.snapshot(codec.NewEncoder(w))
+}
+
+// Restore reads a snapshot from r into an empty cache.
+func (c *TinyLFU[K, V]) Restore(r io.Reader, codec Codec) error {
+	return restoreSnapshot[K, V](c, codec.NewDecoder(r))
+}
+
+func (c *TinyLFU[K, V]) snapshotKind() string {
+	return tinyLFUSnapshot
+}
+
+func (c *TinyLFU[K, V]) snapshot(enc Encoder) error {
+	err := writeSnapshotHeader(enc, tinyLFUSnapshot, 0, c.window.Len(), c.probation.Len(), c.protected.Len())
+	if err != nil {
+		return err
+	}
+	for _, l := range []*LRU[K, V]{c.window, c.probation, c.protected} {
+		if err = l.writeRecords(enc); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *TinyLFU[K, V]) restoreRecord(_ *snapshotHeader, section int, rec *snapshotRecord[K, V]) {
+	// Restored items count as accessed once, so they are not
+	// displaced by the first new keys.
+	c.sketch.increment(hashKey(c.seed, rec.Key))
+	switch section {
+	case 0:
+		c.window.add(rec.Key, rec.Value)
+	case 1:
+		c.probation.add(rec.Key, rec.Value)
+	case 2:
+		c.protected.add(rec.Key, rec.Value)
+	}
+}
+
+// finishRestore evicts items if the snapshot was taken from a larger cache.
+func (c *TinyLFU[K, V]) finishRestore(_ *snapshotHeader) {
+	c.demote()
+	c.evictWindow()
+	for c.probation.Len()+c.protected.Len() > c.mainSize {
+		victims := c.probation
+		if victims.Len() == 0 {
+			victims = c.protected
+		}
+		k, v, _ := victims.getAndRemoveOldest()
+		c.onEvict.call(k, v, EvictCapacity)
+	}
+}
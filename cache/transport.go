@@ -0,0 +1,378 @@
+package cache
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"sync"
+	"time"
+)
+
+const (
+	// maxUDPMessageSize is the maximum payload of a UDP datagram.
+	maxUDPMessageSize = 65507
+	// maxTCPMessageSize is the maximum message accepted by TCPTransport.
+	maxTCPMessageSize = 1 << 20
+
+	transportDialTimeout = time.Second
+	transportAckTimeout  = time.Second
+	transportBufferSize  = 64
+
+	// The receive loops wait between errors from transportMinRetryDelay,
+	// doubling up to transportMaxRetryDelay.
+	transportMinRetryDelay = 5 * time.Millisecond
+	transportMaxRetryDelay = time.Second
+)
+
+// tcpAck is written back by TCPTransport for each received message.
+var tcpAck = []byte{1}
+
+// retryDelay is the backoff of a receive loop after errors, so that a
+// persistent error does not spin, like in net/http Server.Serve.
+type retryDelay time.Duration
+
+// wait sleeps for the next delay, it returns false if done is closed.
+func (d *retryDelay) wait(done <-chan struct{}) bool {
+	select {
+	case <-done:
+		return false
+	default:
+	}
+
+	if *d == 0 {
+		*d = retryDelay(transportMinRetryDelay)
+	} else {
+		*d *= 2
+	}
+	if *d > retryDelay(transportMaxRetryDelay) {
+		*d = retryDelay(transportMaxRetryDelay)
+	}
+	timer := time.NewTimer(time.Duration(*d))
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+func (d *retryDelay) reset() {
+	*d = 0
+}
+
+// UDPTransport broadcasts messages to a UDP multicast group. Messages are
+// delivered at most once and each message must fit in a datagram, the
+// sender receives its own messages as well. Messages are not
+// authenticated, so the group must only be reachable from a trusted network.
+type UDPTransport struct {
+	conn     *net.UDPConn
+	sender   *net.UDPConn
+	messages chan []byte
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+// NewUDPTransport joins the multicast group address, e.g. "239.0.0.1:9999".
+func NewUDPTransport(group string) (*UDPTransport, error) {
+	addr, err := net.ResolveUDPAddr("udp", group)
+	if err != nil {
+		return nil, err
+	}
+	conn, err := net.ListenMulticastUDP("udp", nil, addr)
+	if err != nil {
+		return nil, err
+	}
+	sender, err := net.DialUDP("udp", nil, addr)
+	if err != nil {
+		conn.Close()
+		return nil, err
+	}
+
+	t := &UDPTransport{
+		conn:     conn,
+		sender:   sender,
+		messages: make(chan []byte, transportBufferSize),
+		done:     make(chan struct{}),
+	}
+	go t.receive()
+	return t, nil
+}
+
+// Broadcast sends msg to the multicast group.
+func (t *UDPTransport) Broadcast(msg []byte) error {
+	if len(msg) > maxUDPMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds UDP datagram size", len(msg))
+	}
+	if _, err := t.sender.Write(msg); err != nil {
+		select {
+		case <-t.done:
+			return ErrTransportClosed
+		default:
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *UDPTransport) receive() {
+	defer close(t.messages)
+
+	var delay retryDelay
+	buf := make([]byte, maxUDPMessageSize)
+	for {
+		n, _, err := t.conn.ReadFromUDP(buf)
+		if err != nil {
+			if !delay.wait(t.done) {
+				return
+			}
+			continue
+		}
+		delay.reset()
+		msg := make([]byte, n)
+		copy(msg, buf[:n])
+		select {
+		case t.messages <- msg:
+		case <-t.done:
+			return
+		}
+	}
+}
+
+// Messages returns the channel of received messages.
+func (t *UDPTransport) Messages() <-chan []byte {
+	return t.messages
+}
+
+// Close leaves the multicast group.
+func (t *UDPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		close(t.done)
+		err = errors.Join(t.conn.Close(), t.sender.Close())
+	})
+	return err
+}
+
+// TCPTransport sends messages to a fixed list of peers over TCP, and
+// receives the messages of peers on a listening address. Connections
+// to peers are established lazily and re-established after errors.
+// Each message is acknowledged by the peer, so Broadcast returns after
+// all peers have received it, or with the errors of the unreachable ones.
+// Connections are neither authenticated nor encrypted, anyone who can
+// connect to the listening address can remove keys from the caches, so
+// it must only be reachable from a trusted network.
+type TCPTransport struct {
+	listener net.Listener
+	peers    []*tcpPeer
+	messages chan []byte
+
+	mu    sync.Mutex
+	conns map[net.Conn]struct{}
+	// wg tracks the goroutines sending to messages.
+	wg sync.WaitGroup
+
+	closeOnce sync.Once
+	done      chan struct{}
+}
+
+type tcpPeer struct {
+	addr string
+
+	mu   sync.Mutex
+	conn net.Conn
+}
+
+// NewTCPTransport listens on addr for the messages of peers,
+// and sends messages to the peers addresses.
+func NewTCPTransport(addr string, peers []string) (*TCPTransport, error) {
+	listener, err := net.Listen("tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+
+	t := &TCPTransport{
+		listener: listener,
+		messages: make(chan []byte, transportBufferSize),
+		conns:    make(map[net.Conn]struct{}),
+		done:     make(chan struct{}),
+	}
+	for _, peer := range peers {
+		t.peers = append(t.peers, &tcpPeer{addr: peer})
+	}
+
+	t.wg.Add(1)
+	go t.accept()
+	return t, nil
+}
+
+// Addr returns the listening address.
+func (t *TCPTransport) Addr() net.Addr {
+	return t.listener.Addr()
+}
+
+// Broadcast sends msg to all peers, it returns the errors of the peers
+// which did not acknowledge it.
+func (t *TCPTransport) Broadcast(msg []byte) error {
+	select {
+	case <-t.done:
+		return ErrTransportClosed
+	default:
+	}
+	if len(msg) > maxTCPMessageSize {
+		return fmt.Errorf("message of %d bytes exceeds %d bytes", len(msg), maxTCPMessageSize)
+	}
+
+	frame := make([]byte, 4+len(msg))
+	binary.BigEndian.PutUint32(frame, uint32(len(msg)))
+	copy(frame[4:], msg)
+
+	var errs []error
+	for _, p := range t.peers {
+		if err := p.send(frame); err != nil {
+			errs = append(errs, fmt.Errorf("send to %s: %w", p.addr, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// send writes frame to the peer, a broken connection is redialed once.
+func (p *tcpPeer) send(frame []byte) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	var err error
+	for attempt := 0; attempt < 2; attempt++ {
+		if p.conn == nil {
+			p.conn, err = net.DialTimeout("tcp", p.addr, transportDialTimeout)
+			if err != nil {
+				p.conn = nil
+				return err
+			}
+		}
+		if err = p.roundTrip(frame); err == nil {
+			return nil
+		}
+		p.conn.Close()
+		p.conn = nil
+	}
+	return err
+}
+
+// roundTrip writes frame and waits for the ack of the peer, a write to a
+// connection closed by the peer may succeed so the ack is the only way to
+// know the frame was received.
+func (p *tcpPeer) roundTrip(frame []byte) error {
+	p.conn.SetDeadline(time.Now().Add(transportAckTimeout))
+	if _, err := p.conn.Write(frame); err != nil {
+		return err
+	}
+	ack := make([]byte, 1)
+	_, err := io.ReadFull(p.conn, ack)
+	return err
+}
+
+func (p *tcpPeer) close() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.conn != nil {
+		p.conn.Close()
+		p.conn = nil
+	}
+}
+
+func (t *TCPTransport) accept() {
+	defer t.wg.Done()
+
+	var delay retryDelay
+	for {
+		conn, err := t.listener.Accept()
+		if err != nil {
+			if !delay.wait(t.done) {
+				return
+			}
+			continue
+		}
+		delay.reset()
+
+		t.mu.Lock()
+		select {
+		case <-t.done:
+			t.mu.Unlock()
+			conn.Close()
+			return
+		default:
+		}
+		t.conns[conn] = struct{}{}
+		t.wg.Add(1)
+		t.mu.Unlock()
+
+		go t.read(conn)
+	}
+}
+
+// read receives the frames of a connection until it is closed.
+func (t *TCPTransport) read(conn net.Conn) {
+	defer func() {
+		t.mu.Lock()
+		delete(t.conns, conn)
+		t.mu.Unlock()
+		conn.Close()
+		t.wg.Done()
+	}()
+
+	r := bufio.NewReader(conn)
+	header := make([]byte, 4)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			return
+		}
+		size := binary.BigEndian.Uint32(header)
+		if size > maxTCPMessageSize {
+			return
+		}
+		msg := make([]byte, size)
+		if _, err := io.ReadFull(r, msg); err != nil {
+			return
+		}
+		select {
+		case t.messages <- msg:
+		case <-t.done:
+			return
+		}
+		if _, err := conn.Write(tcpAck); err != nil {
+			return
+		}
+	}
+}
+
+// Messages returns the channel of received messages.
+func (t *TCPTransport) Messages() <-chan []byte {
+	return t.messages
+}
+
+// Close stops listening and closes all connections.
+func (t *TCPTransport) Close() error {
+	var err error
+	t.closeOnce.Do(func() {
+		t.mu.Lock()
+		close(t.done)
+		for conn := range t.conns {
+			conn.Close()
+		}
+		t.mu.Unlock()
+
+		err = t.listener.Close()
+		for _, p := range t.peers {
+			p.close()
+		}
+		t.wg.Wait()
+		close(t.messages)
+	})
+	return err
+}
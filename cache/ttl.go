@@ -14,127 +14,524 @@
 package cache
 
 import (
+	"container/heap"
 	"context"
+	"fmt"
+	"io"
 	"sync"
 	"time"
 )
 
-type ttlCacheItem struct {
-	value  interface{}
+// gcBatchSize is the maximum number of expired items removed
+// while holding the lock, so that readers are not stalled.
+const gcBatchSize = 1024
+
+type ttlCacheItem[V any] struct {
+	value  V
 	expire time.Time
+	// negative means the key is known not to exist, see PutNegative.
+	negative bool
+}
+
+func (i ttlCacheItem[V]) expired(now time.Time) bool {
+	return i.expire.Before(now)
+}
+
+var _ Cache[uint64, interface{}] = new(TTL[uint64, interface{}])
+
+// LookupState is the state of an item returned by TTL.Lookup.
+type LookupState int
+
+const (
+	// LookupMissing means the item does not exist or is out of the stale grace period
+	LookupMissing LookupState = iota
+	// LookupFresh means the item has not expired
+	LookupFresh
+	// LookupStale means the item has expired but is in the stale grace period
+	LookupStale
+)
+
+func (s LookupState) String() string {
+	switch s {
+	case LookupMissing:
+		return "missing"
+	case LookupFresh:
+		return "fresh"
+	case LookupStale:
+		return "stale"
+	default:
+		return "unknown"
+	}
+}
+
+// LookupResult is an item returned by TTL.Lookup.
+type LookupResult[V any] struct {
+	Value  V
+	Expire time.Time
+	State  LookupState
+	// Negative means the key was put by PutNegative, Value is the zero value.
+	Negative bool
 }
 
 // TTL is a cache that assigns TTL(Time-To-Live) for each items.
-type TTL struct {
+// Items are also kept in a heap ordered by expire time,
+// so GC only visits the items which have expired.
+type TTL[K comparable, V any] struct {
 	sync.RWMutex
 	ctx context.Context
 
-	items      map[uint64]ttlCacheItem
+	items      map[K]*ttlEntry[K, V]
+	expires    ttlHeap[K, V]
 	ttl        time.Duration
 	gcInterval time.Duration
+	// staleGrace is how long items are kept after they expire.
+	staleGrace  time.Duration
+	negativeTTL time.Duration
+	// negatives is the number of negative entries in items,
+	// including the expired ones.
+	negatives int
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
+
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+// NewTTL returns a new uint64 keyed TTL cache.
+func NewTTL(ctx context.Context, gcInterval time.Duration, ttl time.Duration) *TTL[uint64, interface{}] {
+	return NewTTLCache[uint64, interface{}](ctx, gcInterval, ttl)
+}
+
+// NewTTLCache returns a new TTL cache.
+func NewTTLCache[K comparable, V any](ctx context.Context, gcInterval time.Duration, ttl time.Duration) *TTL[K, V] {
+	return NewTTLCacheWithEvict[K, V](ctx, gcInterval, ttl, nil)
+}
+
+// NewTTLCacheWithEvict returns a new TTL cache,
+// onEvict is called whenever an item leaves the cache.
+func NewTTLCacheWithEvict[K comparable, V any](ctx context.Context, gcInterval time.Duration, ttl time.Duration, onEvict EvictCallback[K, V]) *TTL[K, V] {
+	return newTTL(ctx, gcInterval, ttl, onEvict, 0, ttl)
 }
 
-// NewTTL returns a new TTL cache.
-func NewTTL(ctx context.Context, gcInterval time.Duration, ttl time.Duration) *TTL {
-	c := &TTL{
-		ctx:        ctx,
-		items:      make(map[uint64]ttlCacheItem),
-		ttl:        ttl,
-		gcInterval: gcInterval,
+// newTTL returns a new TTL cache with all settings resolved,
+// GC starts after the cache is built as it reads the settings without lock.
+func newTTL[K comparable, V any](ctx context.Context, gcInterval, ttl time.Duration, onEvict EvictCallback[K, V], staleGrace, negativeTTL time.Duration) *TTL[K, V] {
+	stats := newStatsCounter()
+	c := &TTL[K, V]{
+		ctx:         ctx,
+		items:       make(map[K]*ttlEntry[K, V]),
+		ttl:         ttl,
+		gcInterval:  gcInterval,
+		staleGrace:  staleGrace,
+		negativeTTL: negativeTTL,
+		onEvict:     countEvictions(stats, onEvict),
+		stats:       stats,
+		done:        make(chan struct{}),
 	}
 
 	go c.doGC()
 	return c
 }
 
+// NewTTLWithOptions returns a new TTL cache configured by options,
+// only WithStaleGrace, WithNegativeTTL and WithOnEvict apply to TTL.
+// The TTL of negative entries defaults to ttl.
+func NewTTLWithOptions[K comparable, V any](ctx context.Context, gcInterval time.Duration, ttl time.Duration, opts ...Option) (*TTL[K, V], error) {
+	if gcInterval <= 0 {
+		return nil, fmt.Errorf("%w: gc interval %v", ErrInvalidOption, gcInterval)
+	}
+	s, err := applyOptions(opts, forTTL, "TTL")
+	if err != nil {
+		return nil, err
+	}
+	onEvict, err := evictCallback[K, V](s)
+	if err != nil {
+		return nil, err
+	}
+
+	var staleGrace time.Duration
+	if s.staleGrace != nil {
+		staleGrace = *s.staleGrace
+	}
+	negativeTTL := ttl
+	if s.negativeTTL != nil {
+		negativeTTL = *s.negativeTTL
+	}
+	return newTTL(ctx, gcInterval, ttl, onEvict, staleGrace, negativeTTL), nil
+}
+
 // Put puts an item into cache.
-func (c *TTL) Put(key uint64, value interface{}) {
+func (c *TTL[K, V]) Put(key K, value V) {
 	c.PutWithTTL(key, value, c.ttl)
 }
 
 // PutWithTTL puts an item into cache with specified TTL.
-func (c *TTL) PutWithTTL(key uint64, value interface{}, ttl time.Duration) {
+func (c *TTL[K, V]) PutWithTTL(key K, value V, ttl time.Duration) {
+	c.Lock()
+	defer c.Unlock()
+
+	c.stats.put()
+	c.put(key, value, ttl, false, time.Now())
+}
+
+// PutNegative caches that key does not exist, e.g. a "not found" result of
+// the backend, for the negative TTL. Get and Peek do not find the key, and
+// Lookup reports it as Negative.
+func (c *TTL[K, V]) PutNegative(key K) {
 	c.Lock()
 	defer c.Unlock()
 
-	c.items[key] = ttlCacheItem{
-		value:  value,
-		expire: time.Now().Add(ttl),
+	var zero V
+	c.stats.put()
+	c.put(key, zero, c.negativeTTL, true, time.Now())
+}
+
+func (c *TTL[K, V]) put(key K, value V, ttl time.Duration, negative bool, now time.Time) {
+	item := ttlCacheItem[V]{
+		value:    value,
+		expire:   now.Add(ttl),
+		negative: negative,
+	}
+
+	if e, ok := c.items[key]; ok {
+		old := e.ttlCacheItem
+		c.countNegative(old.negative, negative)
+		e.ttlCacheItem = item
+		e.ttl = ttl
+		heap.Fix(&c.expires, e.index)
+		if old.expired(now) {
+			c.onEvict.call(key, old.value, EvictExpired)
+		} else {
+			c.onEvict.call(key, old.value, EvictReplaced)
+		}
+		return
+	}
+
+	e := &ttlEntry[K, V]{ttlCacheItem: item, key: key, ttl: ttl}
+	c.items[key] = e
+	c.countNegative(false, negative)
+	heap.Push(&c.expires, e)
+}
+
+// countNegative updates the count of negative entries when an entry
+// changes from old to new.
+func (c *TTL[K, V]) countNegative(old, new bool) {
+	switch {
+	case !old && new:
+		c.negatives++
+	case old && !new:
+		c.negatives--
 	}
 }
 
 // Get retrives an item from cache.
-func (c *TTL) Get(key uint64) (interface{}, bool) {
+func (c *TTL[K, V]) Get(key K) (V, bool) {
+	val, _, ok := c.GetWithExpiry(key)
+	return val, ok
+}
+
+// GetWithExpiry retrives an item from cache along with its expire time.
+func (c *TTL[K, V]) GetWithExpiry(key K) (V, time.Time, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, ok := c.lookup(key)
+	c.stats.lookup(ok)
+	return item.value, item.expire, ok
+}
+
+// Peek reads an item from cache. The action is no considered 'Use'.
+func (c *TTL[K, V]) Peek(key K) (V, bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	item, ok := c.lookup(key)
+	return item.value, ok
+}
+
+// lookup returns an item which has not expired and is not negative.
+func (c *TTL[K, V]) lookup(key K) (ttlCacheItem[V], bool) {
+	e, ok := c.items[key]
+	if !ok || e.negative || e.expired(time.Now()) {
+		return ttlCacheItem[V]{}, false
+	}
+	return e.ttlCacheItem, true
+}
+
+// Lookup retrives an item from cache, unlike Get it tells a missing item
+// from a stale one, which has expired but is in the stale grace period and
+// may be served while it is refreshed, and from a negative entry.
+// Only fresh items are counted as hits.
+func (c *TTL[K, V]) Lookup(key K) LookupResult[V] {
 	c.RLock()
 	defer c.RUnlock()
 
-	item, ok := c.items[key]
-	if !ok {
-		return nil, false
+	now := time.Now()
+	e, ok := c.items[key]
+	if !ok || e.expired(now.Add(-c.staleGrace)) {
+		c.stats.miss()
+		return LookupResult[V]{State: LookupMissing}
 	}
 
-	if item.expire.Before(time.Now()) {
-		return nil, false
+	res := LookupResult[V]{Value: e.value, Expire: e.expire, State: LookupFresh, Negative: e.negative}
+	if e.expired(now) {
+		res.State = LookupStale
 	}
+	c.stats.lookup(res.State == LookupFresh)
+	return res
+}
 
-	return item.value, true
+// Touch resets the expire time of an item as if it was put again with the
+// same TTL, which makes a sliding expiration. It returns false if the item
+// does not exist or has expired.
+func (c *TTL[K, V]) Touch(key K) bool {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	e, ok := c.items[key]
+	if !ok || e.expired(now) {
+		return false
+	}
+	e.expire = now.Add(e.ttl)
+	heap.Fix(&c.expires, e.index)
+	return true
 }
 
 // Remove eliminates an item from cache.
-func (c *TTL) Remove(key uint64) {
+func (c *TTL[K, V]) Remove(key K) {
 	c.Lock()
 	defer c.Unlock()
 
-	delete(c.items, key)
+	if e, ok := c.items[key]; ok {
+		c.removeEntry(e)
+		c.onEvict.call(key, e.value, EvictRemoved)
+	}
 }
 
-// Len returns current cache size.
-func (c *TTL) Len() int {
+// Elems return all items in cache which have not expired,
+// negative entries are skipped.
+func (c *TTL[K, V]) Elems() []*Item[K, V] {
 	c.RLock()
 	defer c.RUnlock()
 
-	return len(c.items)
+	now := time.Now()
+	elems := make([]*Item[K, V], 0, len(c.items))
+	for k, e := range c.items {
+		if !e.negative && !e.expired(now) {
+			elems = append(elems, &Item[K, V]{Key: k, Value: e.value})
+		}
+	}
+	return elems
+}
+
+// Range calls f for each item which has not expired and is not negative
+// until f returns false, f must not call back into the cache.
+func (c *TTL[K, V]) Range(f func(key K, value V) bool) {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := time.Now()
+	for k, e := range c.items {
+		if !e.negative && !e.expired(now) && !f(k, e.value) {
+			return
+		}
+	}
+}
+
+// RemoveIf eliminates the items which have not expired, are not negative
+// and for which f returns true, it returns the count.
+func (c *TTL[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	n := 0
+	for k, e := range c.items {
+		if !e.negative && !e.expired(now) && f(k, e.value) {
+			c.removeEntry(e)
+			c.onEvict.call(k, e.value, EvictRemoved)
+			n++
+		}
+	}
+	return n
+}
+
+// Keys returns the keys of all items which have not expired,
+// negative entries are skipped.
+func (c *TTL[K, V]) Keys() []K {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := time.Now()
+	keys := make([]K, 0, len(c.items))
+	for k, e := range c.items {
+		if !e.negative && !e.expired(now) {
+			keys = append(keys, k)
+		}
+	}
+	return keys
+}
+
+// Purge eliminates all items from cache, it is the same as Clear.
+func (c *TTL[K, V]) Purge() {
+	c.Clear()
+}
+
+// Len returns current cache size, expired items and negative entries
+// are not counted even if they have not been removed by GC yet.
+func (c *TTL[K, V]) Len() int {
+	c.RLock()
+	defer c.RUnlock()
+
+	expired, negatives := c.expires.countExpired(time.Now())
+	return len(c.items) - c.negatives - (expired - negatives)
+}
+
+// Cost returns the total cost of items in cache, each item costs 1.
+func (c *TTL[K, V]) Cost() int64 {
+	return int64(c.Len())
+}
+
+// Cap returns 0 as TTL cache is not bounded by size.
+func (c *TTL[K, V]) Cap() int {
+	return 0
+}
+
+// Stats returns the counters of cache.
+func (c *TTL[K, V]) Stats() Stats {
+	return c.stats.snapshot()
 }
 
 // Clear removes all items in the ttl cache.
-func (c *TTL) Clear() {
+func (c *TTL[K, V]) Clear() {
 	c.Lock()
 	defer c.Unlock()
 
-	for k := range c.items {
-		delete(c.items, k)
+	items := c.items
+	c.items = make(map[K]*ttlEntry[K, V])
+	c.expires = nil
+	c.negatives = 0
+	for k, e := range items {
+		c.onEvict.call(k, e.value, EvictRemoved)
 	}
 }
 
-func (c *TTL) doGC() {
+// Snapshot writes all items in cache which have not expired to w,
+// along with their remaining TTL. Negative entries are not written.
+func (c *TTL[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	c.RLock()
+	defer c.RUnlock()
+
+	now := time.Now()
+	enc := codec.NewEncoder(w)
+	n := 0
+	for _, e := range c.items {
+		if !e.negative && !e.expired(now) {
+			n++
+		}
+	}
+	if err := writeSnapshotHeader(enc, ttlSnapshot, 0, n); err != nil {
+		return err
+	}
+	for _, e := range c.items {
+		if e.negative || e.expired(now) {
+			continue
+		}
+		rec := &snapshotRecord[K, V]{Key: e.key, Value: e.value, TTL: e.expire.Sub(now)}
+		if err := enc.Encode(rec); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Restore reads a snapshot from r into an empty cache. Items expire after
+// their remaining TTL when the snapshot was taken.
+func (c *TTL[K, V]) Restore(r io.Reader, codec Codec) error {
+	c.Lock()
+	defer c.Unlock()
+
+	now := time.Now()
+	if expired, _ := c.expires.countExpired(now); len(c.items) != expired {
+		return ErrRestoreNotEmpty
+	}
+	dec := codec.NewDecoder(r)
+	h, err := readSnapshotHeader(dec, ttlSnapshot)
+	if err != nil {
+		return err
+	}
+	return readSnapshotRecords(dec, h, func(_ int, rec *snapshotRecord[K, V]) {
+		c.put(rec.Key, rec.Value, rec.TTL, false, now)
+	})
+}
+
+func (c *TTL[K, V]) removeEntry(e *ttlEntry[K, V]) {
+	heap.Remove(&c.expires, e.index)
+	delete(c.items, e.key)
+	c.countNegative(e.negative, false)
+}
+
+func (c *TTL[K, V]) doGC() {
 	ticker := time.NewTicker(c.gcInterval)
 	defer ticker.Stop()
 
 	for {
 		select {
 		case <-ticker.C:
-			count := 0
-			now := time.Now()
-			c.Lock()
-			for key := range c.items {
-				if value, ok := c.items[key]; ok {
-					if value.expire.Before(now) {
-						count++
-						delete(c.items, key)
-					}
-				}
-			}
-			c.Unlock()
-			//log.Debug("TTL GC items", zap.Int("count", count))
+			c.gc(time.Now())
 		case <-c.ctx.Done():
 			return
+		case <-c.done:
+			return
+		}
+	}
+}
+
+// Close stops the GC goroutine. The cache is still usable after Close,
+// but expired items are only hidden and never removed.
+func (c *TTL[K, V]) Close() {
+	c.closeOnce.Do(func() {
+		close(c.done)
+	})
+}
+
+// gc removes the items expired before now and out of the stale grace
+// period, and returns the count.
+func (c *TTL[K, V]) gc(now time.Time) int {
+	now = now.Add(-c.staleGrace)
+	count := 0
+	for {
+		n, more := c.gcBatch(now)
+		count += n
+		if !more {
+			return count
+		}
+	}
+}
+
+// gcBatch removes at most gcBatchSize expired items,
+// it reports whether there may be more expired items.
+func (c *TTL[K, V]) gcBatch(now time.Time) (int, bool) {
+	c.Lock()
+	defer c.Unlock()
+
+	for n := 0; n < gcBatchSize; n++ {
+		if len(c.expires) == 0 || !c.expires[0].expired(now) {
+			return n, false
 		}
+		e := heap.Pop(&c.expires).(*ttlEntry[K, V])
+		delete(c.items, e.key)
+		c.countNegative(e.negative, false)
+		c.onEvict.call(e.key, e.value, EvictExpired)
 	}
+	return gcBatchSize, true
 }
 
 // TTLUint64 is simple TTL saves only uint64s.
 type TTLUint64 struct {
-	*TTL
+	*TTL[uint64, interface{}]
 }
 
 // NewIDTTL creates a new TTLUint64 cache.
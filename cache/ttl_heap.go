@@ -0,0 +1,68 @@
+package cache
+
+import (
+	"time"
+)
+
+// ttlEntry is an item of TTL cache which knows its position in ttlHeap.
+type ttlEntry[K comparable, V any] struct {
+	ttlCacheItem[V]
+	key K
+	// ttl is kept for Touch to slide the expire time.
+	ttl   time.Duration
+	index int
+}
+
+// ttlHeap is a min-heap of entries ordered by expire time,
+// it implements heap.Interface.
+type ttlHeap[K comparable, V any] []*ttlEntry[K, V]
+
+func (h ttlHeap[K, V]) Len() int {
+	return len(h)
+}
+
+func (h ttlHeap[K, V]) Less(i, j int) bool {
+	return h[i].expire.Before(h[j].expire)
+}
+
+func (h ttlHeap[K, V]) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ttlHeap[K, V]) Push(x interface{}) {
+	e := x.(*ttlEntry[K, V])
+	e.index = len(*h)
+	*h = append(*h, e)
+}
+
+func (h *ttlHeap[K, V]) Pop() interface{} {
+	old := *h
+	n := len(old)
+	e := old[n-1]
+	old[n-1] = nil
+	e.index = -1
+	*h = old[:n-1]
+	return e
+}
+
+// countExpired returns the number of entries expired before now and how
+// many of them are negative, it only visits the expired entries and their
+// direct children.
+func (h ttlHeap[K, V]) countExpired(now time.Time) (count, negatives int) {
+	stack := []int{0}
+	for len(stack) > 0 {
+		i := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+		if i >= len(h) || !h[i].expired(now) {
+			continue
+		}
+		count++
+		if h[i].negative {
+			negatives++
+		}
+		stack = append(stack, 2*i+1, 2*i+2)
+	}
+	return count, negatives
+}
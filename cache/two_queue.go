@@ -13,6 +13,10 @@
 
 package cache
 
+import (
+	"io"
+)
+
 const (
 
 	// defaultRecentRatio is the ratio of the 2Q cache dedicated
@@ -34,101 +38,192 @@ const (
 // head. The ARCCache is similar, but does not require setting any
 // parameters.
 // TwoQueue implementation is based on https://github.com/hashicorp/golang-lru/blob/master/2q.go
-type TwoQueue struct {
+type TwoQueue[K comparable, V any] struct {
 	size       int
 	recentSize int
 
-	recent   *LRU
-	frequent *LRU
-	ghost    *LRU
+	// maxCost is the maximum total cost of items, 0 means no limit.
+	// recentCost is the part of maxCost dedicated to the recent list.
+	maxCost    int64
+	recentCost int64
+
+	recentRatio float64
+	ghostRatio  float64
+
+	recent   *LRU[K, V]
+	frequent *LRU[K, V]
+	ghost    *LRU[K, struct{}]
+
+	onEvict EvictCallback[K, V]
+	stats   *statsCounter
 }
 
-func newTwoQueue(size int) *TwoQueue {
-	return newTwoQueueParams(size, defaultRecentRatio, defaultGhostRatio)
+func newTwoQueue(size int) *TwoQueue[uint64, interface{}] {
+	return newTypedTwoQueue[uint64, interface{}](size, nil)
 }
 
-func newTwoQueueParams(size int, recentRatio, ghostRatio float64) *TwoQueue {
+func newTypedTwoQueue[K comparable, V any](size int, onEvict EvictCallback[K, V]) *TwoQueue[K, V] {
+	return newTwoQueueParams[K, V](size, defaultRecentRatio, defaultGhostRatio, onEvict)
+}
+
+func newTwoQueueParams[K comparable, V any](size int, recentRatio, ghostRatio float64, onEvict EvictCallback[K, V]) *TwoQueue[K, V] {
 	recentSize := int(float64(size) * recentRatio)
 	ghostSize := int(float64(size) * ghostRatio)
+	stats := newStatsCounter()
 
-	return &TwoQueue{
-		size:       size,
-		recentSize: recentSize,
-		recent:     newLRU(size),
-		frequent:   newLRU(size),
-		ghost:      newLRU(ghostSize),
+	return &TwoQueue[K, V]{
+		size:        size,
+		recentSize:  recentSize,
+		recentRatio: recentRatio,
+		ghostRatio:  ghostRatio,
+		recent:      newListLRU[K, V](size),
+		frequent:    newListLRU[K, V](size),
+		ghost:       newListLRU[K, struct{}](ghostSize),
+		onEvict:     countEvictions(stats, onEvict),
+		stats:       stats,
 	}
 }
 
+// withCost bounds the cache by the total cost of items as well.
+func (c *TwoQueue[K, V]) withCost(maxCost int64, cost CostFunc[V]) *TwoQueue[K, V] {
+	c.maxCost = maxCost
+	c.recentCost = int64(float64(maxCost) * c.recentRatio)
+	c.recent.withCost(0, cost)
+	c.frequent.withCost(0, cost)
+	return c
+}
+
 // Put puts an item into cache.
-func (c *TwoQueue) Put(key uint64, value interface{}) {
+func (c *TwoQueue[K, V]) Put(key K, value V) {
+	c.stats.put()
+
+	cost := c.recent.costOf(value)
+	if c.maxCost != 0 && cost > c.maxCost {
+		// The item can never fit, so it is evicted right away
+		// instead of flushing the whole cache to make room for it.
+		if old, ok := c.frequent.take(key); ok {
+			c.onEvict.call(key, old, EvictReplaced)
+		} else if old, ok := c.recent.take(key); ok {
+			c.onEvict.call(key, old, EvictReplaced)
+		}
+		c.onEvict.call(key, value, EvictCapacity)
+		return
+	}
+
 	// Check if value is in frequent list,
 	// then just update it
-	if c.frequent.contains(key) {
+	if old, ok := c.frequent.take(key); ok {
+		c.ensureSpace(false, cost)
 		c.frequent.Put(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
 		return
 	}
 
 	// Check if value is in recent list,
 	// then move it to frequent list
-	if c.recent.contains(key) {
-		c.recent.Remove(key)
+	if old, ok := c.recent.take(key); ok {
+		c.ensureSpace(false, cost)
 		c.frequent.Put(key, value)
+		c.onEvict.call(key, old, EvictReplaced)
 		return
 	}
 
 	// Check if value is in ghost list,
 	// then put it to frequent list
 	if c.ghost.contains(key) {
-		c.ensureSpace(true)
+		c.stats.ghostHit()
+		c.ensureSpace(true, cost)
 		c.ghost.Remove(key)
 		c.frequent.Put(key, value)
 		return
 	}
 
 	// Put it to recent list
-	c.ensureSpace(false)
+	c.ensureSpace(false, cost)
 	c.recent.Put(key, value)
 }
 
+// ensureSpace evicts items until an item of cost fits into the cache.
 // revive:disable-next-line:flag-parameter
-func (c *TwoQueue) ensureSpace(ghost bool) {
-	recentLen := c.recent.Len()
-	frequentLen := c.frequent.Len()
-	if recentLen+frequentLen < c.size {
-		return
+func (c *TwoQueue[K, V]) ensureSpace(ghost bool, cost int64) {
+	for c.full(cost) {
+		if !c.evict(ghost) {
+			return
+		}
 	}
+}
 
+func (c *TwoQueue[K, V]) full(cost int64) bool {
+	if c.size != 0 && c.recent.Len()+c.frequent.Len() >= c.size {
+		return true
+	}
+	return c.maxCost != 0 && c.Cost()+cost > c.maxCost
+}
+
+// evict evicts one item, it returns false if the cache is empty.
+// revive:disable-next-line:flag-parameter
+func (c *TwoQueue[K, V]) evict(ghost bool) bool {
 	// If recent list is larger than target, evict from there
-	if recentLen > 0 && (recentLen > c.recentSize || (recentLen == c.recentSize && !ghost)) {
-		k, _, _ := c.recent.getAndRemoveOldest()
-		c.ghost.Put(k, nil)
-		return
+	if c.recent.Len() > 0 && (c.recentOverTarget(ghost) || c.frequent.Len() == 0) {
+		k, v, _ := c.recent.getAndRemoveOldest()
+		c.ghost.Put(k, struct{}{})
+		c.trimGhost()
+		c.onEvict.call(k, v, EvictCapacity)
+		return true
 	}
 
 	// Remove from frequent list
-	c.frequent.removeOldest()
+	if k, v, ok := c.frequent.getAndRemoveOldest(); ok {
+		c.onEvict.call(k, v, EvictCapacity)
+		return true
+	}
+	return false
+}
+
+// revive:disable-next-line:flag-parameter
+func (c *TwoQueue[K, V]) recentOverTarget(ghost bool) bool {
+	if c.maxCost != 0 {
+		recentCost := c.recent.Cost()
+		return recentCost > c.recentCost || (recentCost == c.recentCost && !ghost)
+	}
+	recentLen := c.recent.Len()
+	return recentLen > c.recentSize || (recentLen == c.recentSize && !ghost)
+}
+
+// trimGhost keeps the ghost list in proportion to the cache when there is
+// no fixed size to derive the ghost size from.
+func (c *TwoQueue[K, V]) trimGhost() {
+	if c.size != 0 {
+		return
+	}
+	ghostSize := int(float64(c.Len()) * c.ghostRatio)
+	for c.ghost.Len() > ghostSize {
+		c.ghost.removeOldest()
+	}
 }
 
 // Get retrives an item from cache.
-func (c *TwoQueue) Get(key uint64) (interface{}, bool) {
+func (c *TwoQueue[K, V]) Get(key K) (V, bool) {
 	// Check in frequent list
 	if val, ok := c.frequent.Get(key); ok {
+		c.stats.hit()
 		return val, ok
 	}
 
 	// If in recent list, move it to frequent list
-	if val, ok := c.recent.Peek(key); ok {
-		c.recent.Remove(key)
+	if val, ok := c.recent.take(key); ok {
+		c.stats.hit()
 		c.frequent.Put(key, val)
 		return val, ok
 	}
 
-	return nil, false
+	c.stats.miss()
+	var zero V
+	return zero, false
 }
 
 // Peek reads an item from cache. The action is no considered 'Use'.
-func (c *TwoQueue) Peek(key uint64) (interface{}, bool) {
+func (c *TwoQueue[K, V]) Peek(key K) (V, bool) {
 	if val, ok := c.frequent.Peek(key); ok {
 		return val, ok
 	}
@@ -136,11 +231,13 @@ func (c *TwoQueue) Peek(key uint64) (interface{}, bool) {
 }
 
 // Remove eliminates an item from cache.
-func (c *TwoQueue) Remove(key uint64) {
-	if c.frequent.remove(key) {
+func (c *TwoQueue[K, V]) Remove(key K) {
+	if val, ok := c.frequent.take(key); ok {
+		c.onEvict.call(key, val, EvictRemoved)
 		return
 	}
-	if c.recent.remove(key) {
+	if val, ok := c.recent.take(key); ok {
+		c.onEvict.call(key, val, EvictRemoved)
 		return
 	}
 	if c.ghost.remove(key) {
@@ -149,15 +246,111 @@ func (c *TwoQueue) Remove(key uint64) {
 }
 
 // Elems return all items in cache.
-func (c *TwoQueue) Elems() []*Item {
+func (c *TwoQueue[K, V]) Elems() []*Item[K, V] {
 	size := c.Len()
-	elems := make([]*Item, 0, size)
+	elems := make([]*Item[K, V], 0, size)
 	elems = append(elems, c.recent.Elems()...)
 	elems = append(elems, c.frequent.Elems()...)
 	return elems
 }
 
+// Range calls f for each item in cache until f returns false.
+func (c *TwoQueue[K, V]) Range(f func(key K, value V) bool) {
+	if c.recent.rangeItems(f) {
+		c.frequent.rangeItems(f)
+	}
+}
+
+// RemoveIf eliminates the items for which f returns true and returns the count.
+func (c *TwoQueue[K, V]) RemoveIf(f func(key K, value V) bool) int {
+	return c.recent.removeIf(f, c.onEvict) + c.frequent.removeIf(f, c.onEvict)
+}
+
+// Keys returns the keys of all items in cache.
+func (c *TwoQueue[K, V]) Keys() []K {
+	keys := make([]K, 0, c.Len())
+	keys = c.recent.appendKeys(keys)
+	return c.frequent.appendKeys(keys)
+}
+
+// Purge eliminates all items from cache, the ghost list is cleared as well.
+func (c *TwoQueue[K, V]) Purge() {
+	c.recent.removeIf(always[K, V], c.onEvict)
+	c.frequent.removeIf(always[K, V], c.onEvict)
+	c.ghost.removeIf(always[K, struct{}], nil)
+}
+
 // Len returns current cache size.
-func (c *TwoQueue) Len() int {
+func (c *TwoQueue[K, V]) Len() int {
 	return c.recent.Len() + c.frequent.Len()
 }
+
+// Cost returns the total cost of items in cache.
+func (c *TwoQueue[K, V]) Cost() int64 {
+	return c.recent.Cost() + c.frequent.Cost()
+}
+
+// Cap returns the maximum number of items, 0 means no limit.
+func (c *TwoQueue[K, V]) Cap() int {
+	return c.size
+}
+
+// Stats returns the counters of cache.
+func (c *TwoQueue[K, V]) Stats() Stats {
+	return c.stats.snapshot()
+}
+
+// Snapshot writes all items in cache to w, the recent, frequent
+// and ghost lists are kept.
+func (c *TwoQueue[K, V]) Snapshot(w io.Writer, codec Codec) error {
+	return c.snapshot(codec.NewEncoder(w))
+}
+
+// Restore reads a snapshot from r into an empty cache.
+func (c *TwoQueue[K, V]) Restore(r io.Reader, codec Codec) error {
+	return restoreSnapshot[K, V](c, codec.NewDecoder(r))
+}
+
+func (c *TwoQueue[K, V]) snapshotKind() string {
+	return twoQueueSnapshot
+}
+
+func (c *TwoQueue[K, V]) snapshot(enc Encoder) error {
+	err := writeSnapshotHeader(enc, twoQueueSnapshot, 0, c.recent.Len(), c.frequent.Len(), c.ghost.Len())
+	if err != nil {
+		return err
+	}
+	if err = c.recent.writeRecords(enc); err != nil {
+		return err
+	}
+	if err = c.frequent.writeRecords(enc); err != nil {
+		return err
+	}
+	for ele := c.ghost.ll.Back(); ele != nil; ele = ele.Prev() {
+		kv := ele.Value.(*lruEntry[K, struct{}])
+		if err = enc.Encode(&snapshotRecord[K, V]{Key: kv.Key}); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (c *TwoQueue[K, V]) restoreRecord(_ *snapshotHeader, section int, rec *snapshotRecord[K, V]) {
+	switch section {
+	case 0:
+		c.recent.add(rec.Key, rec.Value)
+	case 1:
+		c.frequent.add(rec.Key, rec.Value)
+	case 2:
+		c.ghost.add(rec.Key, struct{}{})
+	}
+}
+
+// finishRestore evicts items if the snapshot was taken from a larger cache.
+func (c *TwoQueue[K, V]) finishRestore(_ *snapshotHeader) {
+	for (c.size != 0 && c.Len() > c.size) || (c.maxCost != 0 && c.Cost() > c.maxCost) {
+		if !c.evict(false) {
+			return
+		}
+	}
+}
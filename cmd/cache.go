@@ -0,0 +1,229 @@
+package cmd
+
+import (
+	"bufio"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+	"github.com/tianhongw/misc-go/cache"
+)
+
+const (
+	traceFormatAuto  = "auto"
+	traceFormatLines = "lines"
+	traceFormatCSV   = "csv"
+
+	outputTable = "table"
+	outputCSV   = "csv"
+)
+
+var (
+	simTypes       []string
+	simSizes       []int
+	simTraceFormat string
+	simKeyColumn   int
+	simHeader      bool
+	simOutput      string
+)
+
+var cacheCmd = cobra.Command{
+	Use:   "cache",
+	Short: "Cache tools",
+	// Overrides the one of rootCmd, so the cache tools neither need the
+	// app config nor print to the piped output.
+	PersistentPreRun: func(cmd *cobra.Command, args []string) {},
+}
+
+var simulateCmd = cobra.Command{
+	Use:   "simulate <trace file>",
+	Short: "Replay an access trace against caches and print the hit ratios",
+	Long: `Replay an access trace against each cache type at each size and print the hit ratios.
+
+The trace file has one key per line, or is a CSV file whose key column is
+selected by --key-column, e.g. "timestamp,key". A key is put into the cache
+whenever it is missed.`,
+	Args: cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		return simulate(cmd.OutOrStdout(), args[0])
+	},
+}
+
+func init() {
+	simulateCmd.Flags().StringSliceVar(&simTypes, "types", []string{"lru", "2q", "fifo"}, "cache types to simulate: lru, 2q, arc, tinylfu, fifo")
+	simulateCmd.Flags().IntSliceVar(&simSizes, "sizes", []int{100, 1000, 10000}, "cache sizes to simulate")
+	simulateCmd.Flags().StringVar(&simTraceFormat, "trace-format", traceFormatAuto, "trace file format: auto, lines or csv, auto uses csv for .csv files")
+	simulateCmd.Flags().IntVar(&simKeyColumn, "key-column", 1, "zero based index of the key column of csv trace")
+	simulateCmd.Flags().BoolVar(&simHeader, "header", false, "skip the first line of csv trace")
+	simulateCmd.Flags().StringVarP(&simOutput, "output", "o", outputTable, "output format: table or csv")
+
+	cacheCmd.AddCommand(&simulateCmd)
+	rootCmd.AddCommand(&cacheCmd)
+}
+
+// simCache is the part of a cache used by the simulation.
+type simCache interface {
+	Get(key string) (struct{}, bool)
+	Put(key string, value struct{})
+}
+
+func newSimCache(name string, size int) (simCache, error) {
+	var cacheType cache.Type
+	switch name {
+	case "lru":
+		cacheType = cache.LRUCache
+	case "2q":
+		cacheType = cache.TwoQueueCache
+	case "arc":
+		cacheType = cache.ARCCache
+	case "tinylfu":
+		cacheType = cache.TinyLFUCache
+	case "fifo":
+		return cache.NewFIFOCache[string, struct{}](size), nil
+	default:
+		return nil, fmt.Errorf("unknown cache type: %s", name)
+	}
+	return cache.NewWithOptions[string, struct{}](size, cacheType)
+}
+
+func simulate(w io.Writer, traceFile string) error {
+	keys, err := readTrace(traceFile)
+	if err != nil {
+		return err
+	}
+	if len(keys) == 0 {
+		return fmt.Errorf("empty trace file: %s", traceFile)
+	}
+
+	// ratios[i][j] is the hit ratio of simSizes[i] and simTypes[j].
+	ratios := make([][]float64, len(simSizes))
+	for i, size := range simSizes {
+		ratios[i] = make([]float64, len(simTypes))
+		for j, name := range simTypes {
+			c, err := newSimCache(name, size)
+			if err != nil {
+				return err
+			}
+			ratios[i][j] = replay(c, keys)
+		}
+	}
+
+	switch simOutput {
+	case outputTable:
+		return writeTable(w, ratios)
+	case outputCSV:
+		return writeCSV(w, ratios)
+	default:
+		return fmt.Errorf("unknown output format: %s", simOutput)
+	}
+}
+
+// replay replays keys against c and returns the hit ratio.
+func replay(c simCache, keys []string) float64 {
+	hits := 0
+	for _, key := range keys {
+		if _, ok := c.Get(key); ok {
+			hits++
+		} else {
+			c.Put(key, struct{}{})
+		}
+	}
+	return float64(hits) / float64(len(keys))
+}
+
+func readTrace(traceFile string) ([]string, error) {
+	f, err := os.Open(traceFile)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format := simTraceFormat
+	if format == traceFormatAuto {
+		format = traceFormatLines
+		if strings.EqualFold(filepath.Ext(traceFile), ".csv") {
+			format = traceFormatCSV
+		}
+	}
+
+	switch format {
+	case traceFormatLines:
+		return readLinesTrace(f)
+	case traceFormatCSV:
+		return readCSVTrace(f)
+	default:
+		return nil, fmt.Errorf("unknown trace format: %s", format)
+	}
+}
+
+// readLinesTrace reads one key per line, empty lines are skipped.
+func readLinesTrace(r io.Reader) ([]string, error) {
+	var keys []string
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		if key := strings.TrimSpace(scanner.Text()); key != "" {
+			keys = append(keys, key)
+		}
+	}
+	return keys, scanner.Err()
+}
+
+func readCSVTrace(r io.Reader) ([]string, error) {
+	var keys []string
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.ReuseRecord = true
+	for line := 1; ; line++ {
+		record, err := reader.Read()
+		if err == io.EOF {
+			return keys, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		if line == 1 && simHeader {
+			continue
+		}
+		if simKeyColumn < 0 || simKeyColumn >= len(record) {
+			return nil, fmt.Errorf("line %d: no key column %d", line, simKeyColumn)
+		}
+		keys = append(keys, record[simKeyColumn])
+	}
+}
+
+func writeTable(w io.Writer, ratios [][]float64) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', tabwriter.AlignRight)
+	fmt.Fprintf(tw, "size\t%s\t\n", strings.Join(simTypes, "\t"))
+	for i, size := range simSizes {
+		fmt.Fprintf(tw, "%d", size)
+		for _, ratio := range ratios[i] {
+			fmt.Fprintf(tw, "\t%.2f%%", ratio*100)
+		}
+		fmt.Fprintln(tw, "\t")
+	}
+	return tw.Flush()
+}
+
+func writeCSV(w io.Writer, ratios [][]float64) error {
+	cw := csv.NewWriter(w)
+	if err := cw.Write(append([]string{"size"}, simTypes...)); err != nil {
+		return err
+	}
+	for i, size := range simSizes {
+		record := []string{strconv.Itoa(size)}
+		for _, ratio := range ratios[i] {
+			record = append(record, strconv.FormatFloat(ratio, 'f', 4, 64))
+		}
+		if err := cw.Write(record); err != nil {
+			return err
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,124 @@
+package cmd
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/tianhongw/misc-go/util/assert"
+)
+
+// setSimFlags sets the simulate flags for a test and restores them after.
+func setSimFlags(t *testing.T, types []string, sizes []int) {
+	oldTypes, oldSizes := simTypes, simSizes
+	oldFormat, oldColumn, oldHeader, oldOutput := simTraceFormat, simKeyColumn, simHeader, simOutput
+	t.Cleanup(func() {
+		simTypes, simSizes = oldTypes, oldSizes
+		simTraceFormat, simKeyColumn, simHeader, simOutput = oldFormat, oldColumn, oldHeader, oldOutput
+	})
+
+	simTypes, simSizes = types, sizes
+	simTraceFormat, simKeyColumn, simHeader, simOutput = traceFormatAuto, 1, false, outputTable
+}
+
+func writeTrace(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestReadTrace(t *testing.T) {
+	setSimFlags(t, nil, nil)
+
+	keys, err := readTrace(writeTrace(t, "trace.txt", "a\n\n  b \nc\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "c"}, keys)
+
+	// .csv files are read as csv, the key column is selected by --key-column.
+	simHeader = true
+	keys, err = readTrace(writeTrace(t, "trace.csv", "ts,key\n1,a\n2,b\n3,a\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b", "a"}, keys)
+
+	simHeader = false
+	simKeyColumn = 0
+	keys, err = readTrace(writeTrace(t, "trace.csv", "a,x\nb\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"a", "b"}, keys)
+
+	simKeyColumn = 2
+	_, err = readTrace(writeTrace(t, "trace.csv", "1,a\n"))
+	assert.NotNil(t, err)
+
+	// The format flag overrides the file extension.
+	simTraceFormat = traceFormatLines
+	keys, err = readTrace(writeTrace(t, "trace.csv", "1,a\n"))
+	assert.Nil(t, err)
+	assert.Equal(t, []string{"1,a"}, keys)
+
+	simTraceFormat = "xml"
+	_, err = readTrace(writeTrace(t, "trace.txt", "a\n"))
+	assert.NotNil(t, err)
+}
+
+func TestReplay(t *testing.T) {
+	c, err := newSimCache("lru", 2)
+	assert.Nil(t, err)
+	// a and b are missed, a is hit, c evicts b, a is hit and b is missed.
+	assert.Equal(t, 2.0/6, replay(c, []string{"a", "b", "a", "c", "a", "b"}))
+
+	c, err = newSimCache("fifo", 1)
+	assert.Nil(t, err)
+	assert.Equal(t, 0.5, replay(c, []string{"a", "a", "b", "b"}))
+
+	_, err = newSimCache("mru", 1)
+	assert.NotNil(t, err)
+}
+
+func TestSimulate(t *testing.T) {
+	setSimFlags(t, []string{"lru", "fifo"}, []int{1, 2})
+	trace := writeTrace(t, "trace.txt", "a\nb\na\nc\na\nb\n")
+
+	var buf bytes.Buffer
+	assert.Nil(t, simulate(&buf, trace))
+	var rows [][]string
+	for _, line := range strings.Split(strings.TrimSpace(buf.String()), "\n") {
+		rows = append(rows, strings.Fields(line))
+	}
+	assert.Equal(t, [][]string{
+		{"size", "lru", "fifo"},
+		{"1", "0.00%", "0.00%"},
+		{"2", "33.33%", "16.67%"},
+	}, rows)
+
+	simOutput = outputCSV
+	buf.Reset()
+	assert.Nil(t, simulate(&buf, trace))
+	assert.Equal(t, "size,lru,fifo\n1,0.0000,0.0000\n2,0.3333,0.1667\n", buf.String())
+
+	simOutput = "json"
+	assert.NotNil(t, simulate(&buf, trace))
+
+	assert.NotNil(t, simulate(&buf, writeTrace(t, "empty.txt", "")))
+}
+
+func TestSimulateWithoutConfig(t *testing.T) {
+	setSimFlags(t, []string{"lru"}, []int{2})
+	trace := writeTrace(t, "trace.txt", "a\na\n")
+	// The cache tools must not load $HOME/.app.toml.
+	t.Setenv("HOME", t.TempDir())
+
+	var buf bytes.Buffer
+	rootCmd.SetOut(&buf)
+	rootCmd.SetArgs([]string{"cache", "simulate", "--output", "csv", trace})
+	t.Cleanup(func() {
+		rootCmd.SetOut(nil)
+		rootCmd.SetArgs(nil)
+	})
+	assert.Nil(t, rootCmd.Execute())
+	assert.Equal(t, "size,lru\n2,0.5000\n", buf.String())
+}
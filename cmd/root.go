@@ -19,14 +19,23 @@ const (
 )
 
 var (
-	cfgFile string
-	cfgType string
+	cfgFile  string
+	cfgType  string
+	watchCfg bool
 )
 
 var rootCmd = cobra.Command{
 	Use: "app",
-	PersistentPreRun: func(cmd *cobra.Command, args []string) {
+	// Loads the config for the subcommands which need it, the ones
+	// which do not override it.
+	PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+		if err := doInit(); err != nil {
+			// The flags are fine, the usage would hide the error.
+			cmd.SilenceUsage = true
+			return err
+		}
 		fmt.Printf("config file used: %s", cfgFile)
+		return nil
 	},
 	Run: func(cmd *cobra.Command, args []string) {
 		run()
@@ -34,21 +43,19 @@ var rootCmd = cobra.Command{
 }
 
 func init() {
-	cobra.OnInitialize(doInit)
-
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", fmt.Sprintf("config file path, default use: %s", defaultCfgFile))
 	rootCmd.PersistentFlags().StringVarP(&cfgType, "type", "t", "", fmt.Sprintf("config file type, default use: %s", defaultCfgType))
 	rootCmd.PersistentFlags().StringP("log", "l", "", "log file path")
+	rootCmd.Flags().BoolVarP(&watchCfg, "watch", "w", false, "reload the log config when the config file changes")
 
 	viper.BindPFlag("log", rootCmd.PersistentFlags().Lookup("log"))
 }
 
-func doInit() {
+func doInit() error {
 	if cfgFile == "" {
 		home, err := homedir.Dir()
 		if err != nil {
-			fmt.Fprintf(os.Stderr, "failed to get home dir: %v", err)
-			os.Exit(1)
+			return fmt.Errorf("failed to get home dir: %w", err)
 		}
 		cfgFile = strings.Replace(defaultCfgFile, "$HOME", home, 1)
 	}
@@ -57,12 +64,12 @@ func doInit() {
 		cfgType = defaultCfgType
 	}
 
-	if cfgFileUsed, err := conf.Init(cfgFile, cfgType); err != nil {
-		fmt.Fprintf(os.Stderr, "failed to load config file: %v", err)
-		os.Exit(1)
-	} else {
-		cfgFile = cfgFileUsed
+	cfgFileUsed, err := conf.Init(cfgFile, cfgType)
+	if err != nil {
+		return fmt.Errorf("failed to load config file: %w", err)
 	}
+	cfgFile = cfgFileUsed
+	return nil
 }
 
 func run() {
@@ -76,6 +83,9 @@ func run() {
 		os.Exit(1)
 	}
 	defer log.Flush()
+	if watchCfg {
+		log.WatchConfig()
+	}
 
 	if err := db.Init(conf.Opts); err != nil {
 		log.Errorf("init database failed: %v", err)
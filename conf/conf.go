@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"path/filepath"
 
+	"github.com/fsnotify/fsnotify"
 	"github.com/spf13/viper"
 	"gopkg.in/go-playground/validator.v9"
 )
@@ -18,6 +19,9 @@ const (
 
 var (
 	Opts *Options
+
+	// cfg is the viper instance of the config file loaded by Init.
+	cfg *viper.Viper
 )
 
 type (
@@ -94,10 +98,22 @@ func Init(filePath, fileType string) (string, error) {
 		return "", fmt.Errorf("read confing failed, error: %v", err)
 	}
 
+	o, err := load(v)
+	if err != nil {
+		return "", err
+	}
+
+	Opts = o
+	cfg = v
+
+	return v.ConfigFileUsed(), nil
+}
+
+func load(v *viper.Viper) (*Options, error) {
 	o := new(Options)
 
 	if err := v.Unmarshal(o); err != nil {
-		return "", fmt.Errorf("unmarshal config failed, error: %v", err)
+		return nil, fmt.Errorf("unmarshal config failed, error: %v", err)
 	}
 
 	logFlag := viper.GetString("log")
@@ -107,9 +123,29 @@ func Init(filePath, fileType string) (string, error) {
 		o.Log.ErrOutput = []string{fmt.Sprintf("%s/error.log", logFolder)}
 	}
 
-	Opts = o
+	return o, nil
+}
 
-	return v.ConfigFileUsed(), nil
+// Watch watches the config file loaded by Init, onChange is called with the
+// new options or the error of loading them whenever the file changes.
+// Opts is not updated, the subsystems apply the changes they support.
+func Watch(onChange func(o *Options, err error)) {
+	if cfg == nil {
+		panic("conf is not inited.")
+	}
+
+	cfg.OnConfigChange(func(fsnotify.Event) {
+		o, err := load(cfg)
+		if err == nil {
+			err = o.Validate()
+		}
+		if err != nil {
+			onChange(nil, err)
+			return
+		}
+		onChange(o, nil)
+	})
+	cfg.WatchConfig()
 }
 
 func (o *Options) Validate() error {
@@ -1,28 +1,39 @@
 module github.com/tianhongw/misc-go
 
-go 1.14
+go 1.21
 
 require (
-	github.com/fsnotify/fsnotify v1.4.9 // indirect
-	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-xorm/xorm v0.7.9
-	github.com/leodido/go-urn v1.2.0 // indirect
 	github.com/mitchellh/go-homedir v1.1.0
+	github.com/pingcap/check v0.0.0-20190102082844-67f458068fc8
+	github.com/spf13/cobra v0.0.6
+	github.com/spf13/viper v1.6.2
+	go.uber.org/zap v1.14.1
+	gopkg.in/go-playground/validator.v9 v9.31.0
+	gopkg.in/natefinch/lumberjack.v2 v2.0.0
+	xorm.io/core v0.7.2-0.20190928055935-90aeac8d08eb
+)
+
+require (
+	github.com/go-playground/locales v0.13.0 // indirect
+	github.com/go-playground/universal-translator v0.17.0 // indirect
+	github.com/hashicorp/hcl v1.0.0 // indirect
+	github.com/leodido/go-urn v1.2.0 // indirect
+	github.com/magiconair/properties v1.8.1 // indirect
 	github.com/mitchellh/mapstructure v1.2.2 // indirect
 	github.com/pelletier/go-toml v1.6.0 // indirect
-	github.com/pingcap/check v0.0.0-20190102082844-67f458068fc8
 	github.com/spf13/afero v1.2.2 // indirect
 	github.com/spf13/cast v1.3.1 // indirect
-	github.com/spf13/cobra v0.0.6
 	github.com/spf13/jwalterweatherman v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.5 // indirect
-	github.com/spf13/viper v1.6.2
-	go.uber.org/zap v1.14.1
+	github.com/subosito/gotenv v1.2.0 // indirect
+	go.uber.org/atomic v1.6.0 // indirect
+	go.uber.org/multierr v1.5.0 // indirect
 	golang.org/x/sys v0.0.0-20200320181252-af34d8274f85 // indirect
+	golang.org/x/text v0.3.2 // indirect
 	gopkg.in/go-playground/assert.v1 v1.2.1 // indirect
-	gopkg.in/go-playground/validator.v9 v9.31.0
 	gopkg.in/ini.v1 v1.55.0 // indirect
-	gopkg.in/natefinch/lumberjack.v2 v2.0.0
 	gopkg.in/yaml.v2 v2.2.8 // indirect
-	xorm.io/core v0.7.2-0.20190928055935-90aeac8d08eb
+	xorm.io/builder v0.3.6 // indirect
 )
@@ -0,0 +1,80 @@
+package log
+
+import (
+	"context"
+)
+
+const (
+	// RequestIDKey is the field key of the ID set by ContextWithRequestID
+	RequestIDKey = "request_id"
+	// TraceIDKey is the field key of the ID set by ContextWithTraceID
+	TraceIDKey = "trace_id"
+)
+
+type (
+	fieldsCtxKey struct{}
+	loggerCtxKey struct{}
+)
+
+// ContextWithFields returns a copy of ctx which carries fields in addition
+// to the fields of ctx, fields are key-value pairs or zap.Field values as in
+// Infow. They are added to the loggers returned by WithContext and FromContext.
+func ContextWithFields(ctx context.Context, fields ...interface{}) context.Context {
+	if len(fields) == 0 {
+		return ctx
+	}
+	parent := FieldsFromContext(ctx)
+	// parent is shared by other contexts, so it must be copied before appending.
+	merged := make([]interface{}, 0, len(parent)+len(fields))
+	merged = append(merged, parent...)
+	merged = append(merged, fields...)
+	return context.WithValue(ctx, fieldsCtxKey{}, merged)
+}
+
+// ContextWithRequestID returns a copy of ctx which carries the request id.
+func ContextWithRequestID(ctx context.Context, id string) context.Context {
+	return ContextWithFields(ctx, RequestIDKey, id)
+}
+
+// ContextWithTraceID returns a copy of ctx which carries the trace id.
+func ContextWithTraceID(ctx context.Context, id string) context.Context {
+	return ContextWithFields(ctx, TraceIDKey, id)
+}
+
+// FieldsFromContext returns the fields carried by ctx, the result must not be modified.
+func FieldsFromContext(ctx context.Context) []interface{} {
+	fields, _ := ctx.Value(fieldsCtxKey{}).([]interface{})
+	return fields
+}
+
+// NewContext returns a copy of ctx which carries l, it is returned by
+// FromContext. l should not carry the fields of ctx already, as FromContext
+// adds them again.
+func NewContext(ctx context.Context, l ILogger) context.Context {
+	return context.WithValue(ctx, loggerCtxKey{}, l)
+}
+
+// FromContext returns the logger carried by ctx, or the global logger if
+// there is none, with the fields of ctx added.
+func FromContext(ctx context.Context) ILogger {
+	if l, ok := ctx.Value(loggerCtxKey{}).(ILogger); ok {
+		return l.WithContext(ctx)
+	}
+	return WithContext(ctx)
+}
+
+// WithContext returns the global logger with the fields of ctx added.
+func WithContext(ctx context.Context) ILogger {
+	if logger == nil {
+		panic("log is not inited.")
+	}
+	return logger.WithContext(ctx)
+}
+
+func (l *zapLogger) WithContext(ctx context.Context) ILogger {
+	fields := FieldsFromContext(ctx)
+	if len(fields) == 0 {
+		return l
+	}
+	return l.With(fields...)
+}
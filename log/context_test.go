@@ -0,0 +1,56 @@
+package log
+
+import (
+	"context"
+	"testing"
+
+	"github.com/tianhongw/misc-go/util/assert"
+)
+
+func TestContextFields(t *testing.T) {
+	ctx := context.Background()
+	assert.Equal(t, true, ContextWithFields(ctx) == ctx)
+	assert.Nil(t, FieldsFromContext(ctx))
+
+	ctx = ContextWithRequestID(ctx, "req-1")
+	ctx = ContextWithTraceID(ctx, "trace-1")
+	assert.Equal(t, []interface{}{RequestIDKey, "req-1", TraceIDKey, "trace-1"}, FieldsFromContext(ctx))
+
+	// Contexts derived from the same parent do not share fields.
+	a := ContextWithFields(ctx, "a", 1)
+	b := ContextWithFields(ctx, "b", 2)
+	assert.Equal(t, []interface{}{RequestIDKey, "req-1", TraceIDKey, "trace-1", "a", 1}, FieldsFromContext(a))
+	assert.Equal(t, []interface{}{RequestIDKey, "req-1", TraceIDKey, "trace-1", "b", 2}, FieldsFromContext(b))
+	assert.Equal(t, 4, len(FieldsFromContext(ctx)))
+}
+
+func TestContextLogger(t *testing.T) {
+	logs := observe(t)
+	ctx := ContextWithTraceID(ContextWithRequestID(context.Background(), "req-1"), "trace-1")
+	ids := map[string]interface{}{RequestIDKey: "req-1", TraceIDKey: "trace-1"}
+
+	WithContext(ctx).Info("global")
+	FromContext(ctx).Infow("from", "k", "v")
+	FromContext(context.Background()).Info("plain")
+
+	// The logger carried by ctx is used with the fields of ctx.
+	svc := Named("svc")
+	carried := NewContext(ctx, svc)
+	FromContext(carried).Info("carried")
+	FromContext(ContextWithFields(carried, "user", "bob")).Info("user")
+	svc.WithContext(ctx).Warn("method")
+	assert.Equal(t, true, svc.WithContext(context.Background()) == svc)
+
+	entries := logs.TakeAll()
+	assert.Equal(t, 6, len(entries))
+	assert.Equal(t, ids, entries[0].ContextMap())
+	assert.Equal(t, map[string]interface{}{RequestIDKey: "req-1", TraceIDKey: "trace-1", "k": "v"}, entries[1].ContextMap())
+	assert.Equal(t, map[string]interface{}{}, entries[2].ContextMap())
+	assert.Equal(t, "", entries[2].LoggerName)
+	assert.Equal(t, ids, entries[3].ContextMap())
+	assert.Equal(t, "svc", entries[3].LoggerName)
+	assert.Equal(t, map[string]interface{}{RequestIDKey: "req-1", TraceIDKey: "trace-1", "user": "bob"}, entries[4].ContextMap())
+	assert.Equal(t, "svc", entries[4].LoggerName)
+	assert.Equal(t, ids, entries[5].ContextMap())
+	assert.Equal(t, "svc", entries[5].LoggerName)
+}
@@ -0,0 +1,188 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+
+	"go.uber.org/zap/zapcore"
+)
+
+// LevelHandler is an http.Handler to inspect and change the levels of
+// named loggers at runtime.
+//
+// GET lists the levels of all loggers, or of the logger in the name query
+// parameter. PUT and POST change the level of a logger with a JSON body:
+//
+//	{"name": "db", "level": "debug", "revert_after": "10m"}
+//
+// revert_after is optional, the level is reverted after it, e.g. to turn
+// debug logs off automatically. An empty level makes the logger inherit
+// the level of its parent.
+type LevelHandler struct {
+	mu      sync.Mutex
+	reverts map[*levelNode]*levelRevert
+}
+
+// levelRevert is a scheduled revert of a level change.
+type levelRevert struct {
+	timer *time.Timer
+	// prev is the state before the first change which is not reverted yet.
+	prev levelState
+	at   time.Time
+}
+
+type levelRequest struct {
+	Name        string `json:"name"`
+	Level       string `json:"level"`
+	RevertAfter string `json:"revert_after"`
+}
+
+type levelResponse struct {
+	LoggerLevel
+	RevertAt *time.Time `json:"revert_at,omitempty"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewLevelHandler returns a new LevelHandler.
+func NewLevelHandler() *LevelHandler {
+	return &LevelHandler{
+		reverts: make(map[*levelNode]*levelRevert),
+	}
+}
+
+func (h *LevelHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		h.get(w, r)
+	case http.MethodPut, http.MethodPost:
+		h.set(w, r)
+	default:
+		w.Header().Set("Allow", "GET, PUT, POST")
+		writeJSON(w, http.StatusMethodNotAllowed, errorResponse{Error: "only GET, PUT and POST are supported"})
+	}
+}
+
+func (h *LevelHandler) get(w http.ResponseWriter, r *http.Request) {
+	if !r.URL.Query().Has("name") {
+		all := Levels()
+		res := make([]levelResponse, 0, len(all))
+		for _, l := range all {
+			n, err := levels.get(l.Name)
+			if err != nil {
+				continue
+			}
+			res = append(res, h.response(n))
+		}
+		writeJSON(w, http.StatusOK, res)
+		return
+	}
+
+	n, err := levels.get(r.URL.Query().Get("name"))
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	writeJSON(w, http.StatusOK, h.response(n))
+}
+
+func (h *LevelHandler) set(w http.ResponseWriter, r *http.Request) {
+	var req levelRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid request body: %v", err)})
+		return
+	}
+
+	var (
+		lvl     zapcore.Level
+		inherit = req.Level == ""
+		after   time.Duration
+	)
+	if !inherit {
+		if err := lvl.UnmarshalText([]byte(req.Level)); err != nil {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: err.Error()})
+			return
+		}
+	}
+	if req.RevertAfter != "" {
+		var err error
+		if after, err = time.ParseDuration(req.RevertAfter); err != nil || after <= 0 {
+			writeJSON(w, http.StatusBadRequest, errorResponse{Error: fmt.Sprintf("invalid revert_after %q", req.RevertAfter)})
+			return
+		}
+	}
+
+	n, err := levels.get(req.Name)
+	if err != nil {
+		writeJSON(w, http.StatusNotFound, errorResponse{Error: err.Error()})
+		return
+	}
+	if inherit && n.parent == nil {
+		writeJSON(w, http.StatusBadRequest, errorResponse{Error: "root logger has no parent to inherit level"})
+		return
+	}
+
+	h.mu.Lock()
+	prev := n.state()
+	if rev, ok := h.reverts[n]; ok {
+		// The level goes back to the state before all pending changes.
+		rev.timer.Stop()
+		prev = rev.prev
+		delete(h.reverts, n)
+	}
+	if inherit {
+		n.explicit.Store(false)
+	} else {
+		n.setLevel(lvl)
+	}
+	if after > 0 {
+		h.scheduleRevert(n, prev, after)
+	}
+	res := h.responseLocked(n)
+	h.mu.Unlock()
+
+	writeJSON(w, http.StatusOK, res)
+}
+
+// scheduleRevert restores prev of n after d, h.mu must be held.
+func (h *LevelHandler) scheduleRevert(n *levelNode, prev levelState, d time.Duration) {
+	rev := &levelRevert{prev: prev, at: time.Now().Add(d)}
+	rev.timer = time.AfterFunc(d, func() {
+		h.mu.Lock()
+		defer h.mu.Unlock()
+
+		// The revert may have been replaced while the timer was firing.
+		if h.reverts[n] == rev {
+			n.restore(prev)
+			delete(h.reverts, n)
+		}
+	})
+	h.reverts[n] = rev
+}
+
+func (h *LevelHandler) response(n *levelNode) levelResponse {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	return h.responseLocked(n)
+}
+
+func (h *LevelHandler) responseLocked(n *levelNode) levelResponse {
+	res := levelResponse{LoggerLevel: n.info()}
+	if rev, ok := h.reverts[n]; ok {
+		at := rev.at
+		res.RevertAt = &at
+	}
+	return res
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	_ = json.NewEncoder(w).Encode(v)
+}
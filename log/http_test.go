@@ -0,0 +1,133 @@
+package log
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/tianhongw/misc-go/util/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+// serve sends a request to h and decodes the JSON response into res.
+func serve(t *testing.T, h http.Handler, method, target, body string, res interface{}) int {
+	req := httptest.NewRequest(method, target, strings.NewReader(body))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	if res != nil {
+		// Fields omitted from the response must not keep older values.
+		v := reflect.ValueOf(res).Elem()
+		v.Set(reflect.Zero(v.Type()))
+		if err := json.Unmarshal(rec.Body.Bytes(), res); err != nil {
+			t.Fatalf("invalid response %q: %v", rec.Body.String(), err)
+		}
+	}
+	return rec.Code
+}
+
+func initLevelHandler(t *testing.T) *LevelHandler {
+	assert.Nil(t, Init(loadOptions(t, logConfig{output: filepath.Join(t.TempDir(), "app.log")})))
+	Named("db").Named("raw")
+	return NewLevelHandler()
+}
+
+func TestLevelHandlerGet(t *testing.T) {
+	h := initLevelHandler(t)
+
+	var all []levelResponse
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodGet, "/", "", &all))
+	assert.Equal(t, []levelResponse{
+		{LoggerLevel: LoggerLevel{Name: RootLoggerName, Level: zapcore.InfoLevel}},
+		{LoggerLevel: LoggerLevel{Name: "db", Level: zapcore.InfoLevel, Inherited: true}},
+		{LoggerLevel: LoggerLevel{Name: "db.raw", Level: zapcore.InfoLevel, Inherited: true}},
+	}, all)
+
+	var one levelResponse
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodGet, "/?name=db.raw", "", &one))
+	assert.Equal(t, "db.raw", one.Name)
+
+	var res errorResponse
+	assert.Equal(t, http.StatusNotFound, serve(t, h, http.MethodGet, "/?name=cache", "", &res))
+	assert.Equal(t, `logger "cache" not found`, res.Error)
+
+	req := httptest.NewRequest(http.MethodDelete, "/", nil)
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.Equal(t, "GET, PUT, POST", rec.Header().Get("Allow"))
+}
+
+func TestLevelHandlerSet(t *testing.T) {
+	h := initLevelHandler(t)
+
+	var res levelResponse
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "debug"}`, &res))
+	assert.Equal(t, LoggerLevel{Name: "db", Level: zapcore.DebugLevel}, res.LoggerLevel)
+	assert.Nil(t, res.RevertAt)
+	assert.Equal(t, zapcore.DebugLevel, Named("db").Named("raw").Level())
+
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPost, "/", `{"name": "db.raw", "level": "error"}`, &res))
+	assert.Equal(t, LoggerLevel{Name: "db.raw", Level: zapcore.ErrorLevel}, res.LoggerLevel)
+
+	// An empty level inherits the level of the parent.
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db.raw"}`, &res))
+	assert.Equal(t, LoggerLevel{Name: "db.raw", Level: zapcore.DebugLevel, Inherited: true}, res.LoggerLevel)
+
+	for _, c := range []struct {
+		body string
+		code int
+	}{
+		{`{"name": "db", "level": "loud"}`, http.StatusBadRequest},
+		{`{"name": "db", "level": "debug", "revert_after": "soon"}`, http.StatusBadRequest},
+		{`{"name": "db", "level": "debug", "revert_after": "-1m"}`, http.StatusBadRequest},
+		{`{"name": "db"`, http.StatusBadRequest},
+		{`{"name": ""}`, http.StatusBadRequest},
+		{`{"name": "cache", "level": "debug"}`, http.StatusNotFound},
+	} {
+		var res errorResponse
+		assert.Equal(t, c.code, serve(t, h, http.MethodPut, "/", c.body, &res))
+		assert.NotEqual(t, "", res.Error)
+	}
+	assert.Equal(t, zapcore.DebugLevel, Named("db").Level())
+}
+
+func TestLevelHandlerRevert(t *testing.T) {
+	h := initLevelHandler(t)
+	db := Named("db")
+
+	var res levelResponse
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "debug", "revert_after": "50ms"}`, &res))
+	assert.NotNil(t, res.RevertAt)
+	assert.Equal(t, zapcore.DebugLevel, db.Level())
+	waitLevel(t, "db", LoggerLevel{Name: "db", Level: zapcore.InfoLevel, Inherited: true})
+
+	// A second change cancels the pending revert.
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "debug", "revert_after": "50ms"}`, &res))
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "warn"}`, &res))
+	assert.Nil(t, res.RevertAt)
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, zapcore.WarnLevel, db.Level())
+
+	// A second change with revert_after reverts to the level before both.
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "debug", "revert_after": "50ms"}`, &res))
+	assert.Equal(t, http.StatusOK, serve(t, h, http.MethodPut, "/", `{"name": "db", "level": "error", "revert_after": "300ms"}`, &res))
+	time.Sleep(100 * time.Millisecond)
+	assert.Equal(t, zapcore.ErrorLevel, db.Level())
+	waitLevel(t, "db", LoggerLevel{Name: "db", Level: zapcore.WarnLevel})
+}
+
+// waitLevel waits until the logger of name is at want.
+func waitLevel(t *testing.T, name string, want LoggerLevel) {
+	n, err := levels.get(name)
+	assert.Nil(t, err)
+	for i := 0; i < 100 && n.info() != want; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	assert.Equal(t, want, n.info())
+}
@@ -0,0 +1,196 @@
+package log
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"sync/atomic"
+
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// RootLoggerName is the name of the logger created by Init in the registry.
+const RootLoggerName = ""
+
+// levelNode is the level of a named logger. A node without an explicit
+// level inherits the level of its parent, the root node always has one.
+type levelNode struct {
+	name     string
+	parent   *levelNode
+	level    zap.AtomicLevel
+	explicit atomic.Bool
+}
+
+func newLevelNode(name string, parent *levelNode) *levelNode {
+	return &levelNode{
+		name:   name,
+		parent: parent,
+		level:  zap.NewAtomicLevel(),
+	}
+}
+
+// Level returns the explicit level of the node or the nearest ancestor.
+func (n *levelNode) Level() zapcore.Level {
+	for ; n.parent != nil; n = n.parent {
+		if n.explicit.Load() {
+			break
+		}
+	}
+	return n.level.Level()
+}
+
+func (n *levelNode) Enabled(lvl zapcore.Level) bool {
+	return n.Level().Enabled(lvl)
+}
+
+func (n *levelNode) setLevel(lvl zapcore.Level) {
+	n.level.SetLevel(lvl)
+	n.explicit.Store(true)
+}
+
+// levelState is the own level of a node, it is used to revert a level change.
+type levelState struct {
+	level    zapcore.Level
+	explicit bool
+}
+
+func (n *levelNode) state() levelState {
+	return levelState{level: n.level.Level(), explicit: n.explicit.Load()}
+}
+
+func (n *levelNode) restore(s levelState) {
+	n.level.SetLevel(s.level)
+	n.explicit.Store(s.explicit || n.parent == nil)
+}
+
+func (n *levelNode) info() LoggerLevel {
+	return LoggerLevel{
+		Name:      n.name,
+		Level:     n.Level(),
+		Inherited: n.parent != nil && !n.explicit.Load(),
+	}
+}
+
+// levelRegistry holds the level nodes of all named loggers by full name,
+// e.g. "db.raw", so that loggers of the same name share a level.
+type levelRegistry struct {
+	mu    sync.RWMutex
+	nodes map[string]*levelNode
+}
+
+var levels = &levelRegistry{nodes: make(map[string]*levelNode)}
+
+// reset replaces all nodes with root.
+func (r *levelRegistry) reset(root *levelNode) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.nodes = map[string]*levelNode{root.name: root}
+}
+
+// child returns the node of name under parent, it is created if not exist.
+func (r *levelRegistry) child(parent *levelNode, name string) *levelNode {
+	if parent.name != "" {
+		name = parent.name + "." + name
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if n, ok := r.nodes[name]; ok {
+		return n
+	}
+	n := newLevelNode(name, parent)
+	r.nodes[name] = n
+	return n
+}
+
+func (r *levelRegistry) get(name string) (*levelNode, error) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	n, ok := r.nodes[name]
+	if !ok {
+		return nil, fmt.Errorf("logger %q not found", name)
+	}
+	return n, nil
+}
+
+// LoggerLevel is the level of a named logger.
+type LoggerLevel struct {
+	Name  string        `json:"name"`
+	Level zapcore.Level `json:"level"`
+	// Inherited is true if the level is inherited from the parent logger.
+	Inherited bool `json:"inherited"`
+}
+
+// Levels returns the levels of all loggers created by Named, sorted by name.
+// The root logger is named RootLoggerName.
+func Levels() []LoggerLevel {
+	levels.mu.RLock()
+	defer levels.mu.RUnlock()
+
+	res := make([]LoggerLevel, 0, len(levels.nodes))
+	for _, n := range levels.nodes {
+		res = append(res, n.info())
+	}
+	sort.Slice(res, func(i, j int) bool {
+		return res[i].Name < res[j].Name
+	})
+	return res
+}
+
+// SetLoggerLevel sets the level of the logger of name and the children
+// which do not have their own level.
+func SetLoggerLevel(name string, lvl zapcore.Level) error {
+	n, err := levels.get(name)
+	if err != nil {
+		return err
+	}
+	n.setLevel(lvl)
+	return nil
+}
+
+// ResetLoggerLevel makes the logger of name inherit the level of its parent.
+func ResetLoggerLevel(name string) error {
+	n, err := levels.get(name)
+	if err != nil {
+		return err
+	}
+	if n.parent == nil {
+		return fmt.Errorf("root logger has no parent to inherit level")
+	}
+	n.explicit.Store(false)
+	return nil
+}
+
+// levelCore filters the entries of a core by the level of a named logger,
+// so that named loggers sharing a core have their own levels.
+type levelCore struct {
+	zapcore.Core
+	node *levelNode
+}
+
+// withLevel returns core filtered by node, the filter of a parent logger is replaced.
+func withLevel(core zapcore.Core, node *levelNode) zapcore.Core {
+	if c, ok := core.(*levelCore); ok {
+		core = c.Core
+	}
+	return &levelCore{Core: core, node: node}
+}
+
+func (c *levelCore) Enabled(lvl zapcore.Level) bool {
+	return c.node.Enabled(lvl) && c.Core.Enabled(lvl)
+}
+
+func (c *levelCore) With(fields []zapcore.Field) zapcore.Core {
+	return &levelCore{Core: c.Core.With(fields), node: c.node}
+}
+
+func (c *levelCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if !c.node.Enabled(ent.Level) {
+		return ce
+	}
+	return c.Core.Check(ent, ce)
+}
@@ -0,0 +1,64 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/tianhongw/misc-go/util/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+func TestLoggerLevel(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.Nil(t, Init(loadOptions(t, logConfig{output: path})))
+	db := Named("db")
+	raw := db.Named("raw")
+	with := db.With("k", "v")
+
+	assert.Equal(t, []LoggerLevel{
+		{Name: RootLoggerName, Level: zapcore.InfoLevel},
+		{Name: "db", Level: zapcore.InfoLevel, Inherited: true},
+		{Name: "db.raw", Level: zapcore.InfoLevel, Inherited: true},
+	}, Levels())
+
+	// A level is inherited by the children without their own level.
+	assert.Nil(t, SetLoggerLevel("db", zapcore.DebugLevel))
+	assert.Equal(t, zapcore.DebugLevel, raw.Level())
+	assert.Equal(t, true, raw.ZapLogger().Core().Enabled(zapcore.DebugLevel))
+	assert.Equal(t, false, ZapLogger().Core().Enabled(zapcore.DebugLevel))
+
+	assert.Nil(t, SetLoggerLevel("db.raw", zapcore.ErrorLevel))
+	assert.Equal(t, zapcore.ErrorLevel, raw.Level())
+	assert.Equal(t, zapcore.DebugLevel, db.Level())
+	assert.Equal(t, false, raw.ZapLogger().Core().Enabled(zapcore.WarnLevel))
+
+	// Reset inherits the level of the parent again.
+	assert.Nil(t, ResetLoggerLevel("db.raw"))
+	assert.Equal(t, zapcore.DebugLevel, raw.Level())
+	assert.Equal(t, true, raw.ZapLogger().Core().Enabled(zapcore.DebugLevel))
+	assert.NotNil(t, ResetLoggerLevel(RootLoggerName))
+	assert.NotNil(t, SetLoggerLevel("db.cache", zapcore.DebugLevel))
+	assert.NotNil(t, ResetLoggerLevel("db.cache"))
+
+	// A With child follows the level of its parent.
+	assert.Equal(t, zapcore.DebugLevel, with.Level())
+	db.SetLevel(zapcore.WarnLevel)
+	assert.Equal(t, zapcore.WarnLevel, with.Level())
+	assert.Equal(t, false, with.ZapLogger().Core().Enabled(zapcore.InfoLevel))
+	assert.Equal(t, zapcore.WarnLevel, raw.Level())
+
+	// Reload sets the root level, the levels set on named loggers are kept.
+	db.SetLevel(zapcore.DebugLevel)
+	assert.Nil(t, Reload(loadOptions(t, logConfig{level: "error", output: path})))
+	assert.Equal(t, zapcore.ErrorLevel, Levels()[0].Level)
+	assert.Equal(t, zapcore.DebugLevel, db.Level())
+	assert.Equal(t, zapcore.DebugLevel, raw.Level())
+	with.Debug("with")
+	raw.Debug("raw")
+	Info("root")
+
+	entries := readEntries(t, path)
+	assert.Equal(t, []string{"with", "raw"}, messages(entries))
+	assert.Equal(t, "v", entries[0]["k"])
+	assert.Equal(t, "db.raw", entries[1]["logger"])
+}
@@ -1,6 +1,7 @@
 package log
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"time"
@@ -8,13 +9,15 @@ import (
 	"github.com/tianhongw/misc-go/conf"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
-	"gopkg.in/natefinch/lumberjack.v2"
 )
 
 var _ ILogger = new(zapLogger)
 
 var logger *zapLogger
 
+// cores is the switch of the core of logger, it is swapped by Reload.
+var cores *coreSwitch
+
 type ILogger interface {
 	Debug(args ...interface{})
 	Debugf(format string, args ...interface{})
@@ -31,6 +34,23 @@ type ILogger interface {
 	DPanic(args ...interface{})
 	DPanicf(format string, args ...interface{})
 
+	// The w methods log a message with loosely typed key-value pairs,
+	// zap.Field values are accepted as well, e.g.
+	//  Infow("request done", "path", path, zap.Duration("elapsed", d))
+	Debugw(msg string, keysAndValues ...interface{})
+	Infow(msg string, keysAndValues ...interface{})
+	Warnw(msg string, keysAndValues ...interface{})
+	Errorw(msg string, keysAndValues ...interface{})
+	Fatalw(msg string, keysAndValues ...interface{})
+	Panicw(msg string, keysAndValues ...interface{})
+	DPanicw(msg string, keysAndValues ...interface{})
+
+	// With returns a child logger which adds fields to every log,
+	// fields are key-value pairs or zap.Field values as in Infow.
+	With(fields ...interface{}) ILogger
+	// WithContext returns a child logger which adds the fields of ctx,
+	// see ContextWithFields.
+	WithContext(ctx context.Context) ILogger
 	Named(name string) ILogger
 	Level() zapcore.Level
 	SetLevel(l zapcore.Level)
@@ -40,28 +60,54 @@ type ILogger interface {
 }
 
 type zapLogger struct {
-	base     *zap.Logger
-	zapLevel zap.AtomicLevel
+	base *zap.Logger
+	// level is shared by the loggers of the same name.
+	level    *levelNode
 	children []*zapLogger
 }
 
 func Init(opts *conf.Options) error {
+	files := newFileOutputs()
+	core, zapLevel, err := newCore(opts, files)
+	if err != nil {
+		return err
+	}
+	stackLevel.SetLevel(stackLevelOf(opts))
+
+	root := newLevelNode(RootLoggerName, nil)
+	root.setLevel(zapLevel)
+	levels.reset(root)
+
+	sw := newCoreSwitch(core, files)
+	logger = &zapLogger{
+		base: zap.New(
+			withLevel(sw.root(), root),
+			zap.AddStacktrace(stackLevel),
+			zap.AddCaller(),
+			zap.AddCallerSkip(1),
+		),
+		level: root,
+	}
+	cores = sw
+
+	return nil
+}
+
+// newCore builds the core of the log options, its log files are opened in files.
+func newCore(opts *conf.Options, files *fileOutputs) (zapcore.Core, zapcore.Level, error) {
 	var (
-		zapLevel   zap.AtomicLevel
-		stackLevel zapcore.Level
+		zapLevel   zapcore.Level
 		zapEncoder zapcore.Encoder
 		encoderCfg zapcore.EncoderConfig
 	)
 
 	if err := zapLevel.UnmarshalText([]byte(opts.Log.Level)); err != nil {
-		return fmt.Errorf("failed to set log level: %v", err)
+		return nil, zapLevel, fmt.Errorf("failed to set log level: %v", err)
 	}
 
 	if opts.IsDevMode() {
-		stackLevel = zap.WarnLevel
 		encoderCfg = zap.NewDevelopmentEncoderConfig()
 	} else {
-		stackLevel = zap.ErrorLevel
 		encoderCfg = zap.NewProductionEncoderConfig()
 		encoderCfg.EncodeTime = zapcore.ISO8601TimeEncoder
 		encoderCfg.EncodeDuration = zapcore.StringDurationEncoder
@@ -74,72 +120,53 @@ func Init(opts *conf.Options) error {
 		zapEncoder = zapcore.NewConsoleEncoder(encoderCfg)
 	}
 
+	// The level is checked by levelCore for each named logger.
 	highPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return zapLevel.Enabled(lvl) && lvl >= zapcore.ErrorLevel
+		return lvl >= zapcore.ErrorLevel
 	})
 	lowPriority := zap.LevelEnablerFunc(func(lvl zapcore.Level) bool {
-		return zapLevel.Enabled(lvl) && lvl < zapcore.ErrorLevel
+		return lvl < zapcore.ErrorLevel
 	})
 
 	var cores []zapcore.Core
 
-	for _, infoOut := range opts.Log.Output {
-		cores = append(cores, zapcore.NewCore(zapEncoder, newWriteSyncer(&lumberjack.Logger{
-			Filename:   infoOut,
-			MaxSize:    opts.Log.MaxSize,
-			MaxAge:     opts.Log.MaxAge,
-			MaxBackups: opts.Log.MaxBackups,
-			LocalTime:  true,
-			Compress:   true,
-		}), lowPriority))
+	newOutput := func(filename string) zapcore.WriteSyncer {
+		switch filename {
+		case "stdout":
+			return zapcore.Lock(os.Stdout)
+		case "stderr":
+			return zapcore.Lock(os.Stderr)
+		default:
+			return files.open(filename, rotation{
+				maxSize:    opts.Log.MaxSize,
+				maxAge:     opts.Log.MaxAge,
+				maxBackups: opts.Log.MaxBackups,
+			})
+		}
 	}
 
-	for _, errOut := range opts.Log.ErrOutput {
-		cores = append(cores, zapcore.NewCore(zapEncoder, newWriteSyncer(&lumberjack.Logger{
-			Filename:   errOut,
-			MaxSize:    opts.Log.MaxSize,
-			MaxAge:     opts.Log.MaxAge,
-			MaxBackups: opts.Log.MaxBackups,
-			LocalTime:  true,
-			Compress:   true,
-		}), highPriority))
+	for _, infoOut := range opts.Log.Output {
+		cores = append(cores, zapcore.NewCore(zapEncoder, newOutput(infoOut), lowPriority))
 	}
 
-	logger = &zapLogger{
-		base: zap.New(
-			zapcore.NewTee(cores...),
-			zap.AddStacktrace(stackLevel),
-			zap.AddCaller(),
-			zap.AddCallerSkip(1),
-			zap.WrapCore(func(core zapcore.Core) zapcore.Core {
-				if opts.IsProdMode() {
-					return zapcore.NewSampler(core, time.Second, 100, 100)
-				}
-				return core
-			}),
-		),
-		zapLevel: zapLevel,
+	for _, errOut := range opts.Log.ErrOutput {
+		cores = append(cores, zapcore.NewCore(zapEncoder, newOutput(errOut), highPriority))
 	}
 
-	return nil
-}
-
-func newWriteSyncer(logger *lumberjack.Logger) (w zapcore.WriteSyncer) {
-	switch logger.Filename {
-	case "stdout":
-		w = zapcore.Lock(os.Stdout)
-	case "stderr":
-		w = zapcore.Lock(os.Stderr)
-	default:
-		w = zapcore.AddSync(logger)
+	core := zapcore.NewTee(cores...)
+	if opts.IsProdMode() {
+		core = zapcore.NewSampler(core, time.Second, 100, 100)
 	}
-	return
+	return core, zapLevel, nil
 }
 
 func (l *zapLogger) Named(name string) ILogger {
+	node := levels.child(l.level, name)
 	child := &zapLogger{
-		base:     l.base.Named(name),
-		zapLevel: l.zapLevel,
+		base: l.base.Named(name).WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+			return withLevel(core, node)
+		})),
+		level:    node,
 		children: []*zapLogger{},
 	}
 
@@ -147,16 +174,27 @@ func (l *zapLogger) Named(name string) ILogger {
 	return child
 }
 
+// With returns a child logger which shares the level and the core of l.
+// The child is not added to children, as Flush of l syncs the same core.
+func (l *zapLogger) With(fields ...interface{}) ILogger {
+	return &zapLogger{
+		base:  l.base.Sugar().With(fields...).Desugar(),
+		level: l.level,
+	}
+}
+
 func (l *zapLogger) AddCallerSkip(skip int) {
 	l.base = l.base.WithOptions(zap.AddCallerSkip(skip))
 }
 
+// SetLevel sets the level of the logger, it is shared by the loggers of
+// the same name and inherited by the children without their own level.
 func (l *zapLogger) SetLevel(v zapcore.Level) {
-	l.zapLevel.SetLevel(zapcore.Level(v))
+	l.level.setLevel(v)
 }
 
 func (l *zapLogger) Level() zapcore.Level {
-	return l.zapLevel.Level()
+	return l.level.Level()
 }
 
 func (l *zapLogger) Debug(args ...interface{}) {
@@ -215,6 +253,34 @@ func (l *zapLogger) DPanicf(template string, args ...interface{}) {
 	l.base.DPanic(fmt.Sprintf(template, args...))
 }
 
+func (l *zapLogger) Debugw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Debugw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Infow(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Infow(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Warnw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Warnw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Errorw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Errorw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Fatalw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Fatalw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) Panicw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().Panicw(msg, keysAndValues...)
+}
+
+func (l *zapLogger) DPanicw(msg string, keysAndValues ...interface{}) {
+	l.base.Sugar().DPanicw(msg, keysAndValues...)
+}
+
 func (l *zapLogger) ZapLogger() *zap.Logger {
 	return l.base
 }
@@ -290,6 +356,41 @@ func DPanicf(template string, args ...interface{}) {
 	logger.base.DPanic(fmt.Sprintf(template, args...))
 }
 
+func Debugw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Debugw(msg, keysAndValues...)
+}
+
+func Infow(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Infow(msg, keysAndValues...)
+}
+
+func Warnw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Warnw(msg, keysAndValues...)
+}
+
+func Errorw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Errorw(msg, keysAndValues...)
+}
+
+func Fatalw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Fatalw(msg, keysAndValues...)
+}
+
+func Panicw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().Panicw(msg, keysAndValues...)
+}
+
+func DPanicw(msg string, keysAndValues ...interface{}) {
+	logger.base.Sugar().DPanicw(msg, keysAndValues...)
+}
+
+func With(fields ...interface{}) ILogger {
+	if logger == nil {
+		panic("log is not inited.")
+	}
+	return logger.With(fields...)
+}
+
 func ZapLogger() *zap.Logger {
 	return logger.base
 }
@@ -0,0 +1,88 @@
+package log
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/tianhongw/misc-go/util/assert"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+// observe inits the loggers at debug level and makes them write to an
+// observer core.
+func observe(t *testing.T) *observer.ObservedLogs {
+	assert.Nil(t, Init(loadOptions(t, logConfig{level: "debug", output: filepath.Join(t.TempDir(), "app.log")})))
+	core, logs := observer.New(zapcore.DebugLevel)
+	cores.swap(core)
+	return logs
+}
+
+func TestLoggerFields(t *testing.T) {
+	logs := observe(t)
+	l := Named("svc")
+	l.Debugw("debug", "k", 1)
+	l.Infow("info", "k", "v", zap.Duration("elapsed", time.Second))
+	l.Warnw("warn", "k", true)
+	l.Errorw("error", "k", 1.5)
+	l.DPanicw("dpanic", "k", "v")
+	assert.NotNil(t, func() (r interface{}) {
+		defer func() { r = recover() }()
+		l.Panicw("panic", "k", "v")
+		return nil
+	}())
+	Infow("global", "k", "v")
+
+	entries := logs.TakeAll()
+	assert.Equal(t, 7, len(entries))
+	for i, want := range []struct {
+		level   zapcore.Level
+		msg     string
+		context map[string]interface{}
+	}{
+		{zapcore.DebugLevel, "debug", map[string]interface{}{"k": int64(1)}},
+		{zapcore.InfoLevel, "info", map[string]interface{}{"k": "v", "elapsed": time.Second}},
+		{zapcore.WarnLevel, "warn", map[string]interface{}{"k": true}},
+		{zapcore.ErrorLevel, "error", map[string]interface{}{"k": 1.5}},
+		{zapcore.DPanicLevel, "dpanic", map[string]interface{}{"k": "v"}},
+		{zapcore.PanicLevel, "panic", map[string]interface{}{"k": "v"}},
+		{zapcore.InfoLevel, "global", map[string]interface{}{"k": "v"}},
+	} {
+		entry := entries[i]
+		assert.Equal(t, want.level, entry.Level)
+		assert.Equal(t, want.msg, entry.Message)
+		assert.Equal(t, want.context, entry.ContextMap())
+		// The caller is the code calling the logger, not the logger itself.
+		assert.Equal(t, "logger_test.go", filepath.Base(entry.Caller.File))
+	}
+	assert.Equal(t, "svc", entries[0].LoggerName)
+	assert.Equal(t, "", entries[6].LoggerName)
+}
+
+func TestLoggerWith(t *testing.T) {
+	logs := observe(t)
+	l := Named("svc")
+	w := l.With("user", "bob", zap.Int("n", 2))
+	w.Infow("with", "k", "v")
+	w.With("a", 1).Info("nested")
+	l.Info("parent")
+	With("user", "alice").Info("global")
+
+	entries := logs.TakeAll()
+	assert.Equal(t, 4, len(entries))
+	assert.Equal(t, map[string]interface{}{"user": "bob", "n": int64(2), "k": "v"}, entries[0].ContextMap())
+	assert.Equal(t, "svc", entries[0].LoggerName)
+	assert.Equal(t, map[string]interface{}{"user": "bob", "n": int64(2), "a": int64(1)}, entries[1].ContextMap())
+	assert.Equal(t, map[string]interface{}{}, entries[2].ContextMap())
+	assert.Equal(t, map[string]interface{}{"user": "alice"}, entries[3].ContextMap())
+
+	// The fields are kept when the core is replaced, e.g. by Reload.
+	core, logs := observer.New(zapcore.DebugLevel)
+	cores.swap(core)
+	w.Info("swapped")
+	entries = logs.TakeAll()
+	assert.Equal(t, 1, len(entries))
+	assert.Equal(t, map[string]interface{}{"user": "bob", "n": int64(2)}, entries[0].ContextMap())
+}
@@ -0,0 +1,269 @@
+package log
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+
+	"github.com/tianhongw/misc-go/conf"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
+)
+
+var (
+	// reloadMu serializes Reload.
+	reloadMu sync.Mutex
+
+	// stackLevel is the level from which stacktraces are logged,
+	// it depends on the mode so it is updated by Reload.
+	stackLevel = zap.NewAtomicLevelAt(zap.ErrorLevel)
+)
+
+// stackLevelOf returns the stacktrace level of the mode of opts.
+func stackLevelOf(opts *conf.Options) zapcore.Level {
+	if opts.IsDevMode() {
+		return zap.WarnLevel
+	}
+	return zap.ErrorLevel
+}
+
+// coreVersion is a core built from the log options.
+type coreVersion struct {
+	core zapcore.Core
+}
+
+// coreSwitch holds the current core of logger, all the loggers derived
+// from it switch to a new core atomically on swap.
+type coreSwitch struct {
+	current atomic.Pointer[coreVersion]
+	// files are the log files written by the cores of all versions.
+	files *fileOutputs
+}
+
+// newCoreSwitch returns a switch of core, whose files are opened in files.
+func newCoreSwitch(core zapcore.Core, files *fileOutputs) *coreSwitch {
+	s := &coreSwitch{files: files}
+	s.current.Store(&coreVersion{core: core})
+	files.closeUnused()
+	return s
+}
+
+// root returns the core which writes to the current core of s.
+func (s *coreSwitch) root() zapcore.Core {
+	return &switchCore{sw: s}
+}
+
+// swap replaces the current core, whose files are opened in s.files, and
+// closes the files the new core does not write. An entry checked by the
+// old core before swap is still written to it, it goes to the same file
+// as the new core, or is appended to a file dropped from the options.
+func (s *coreSwitch) swap(core zapcore.Core) {
+	old := s.current.Swap(&coreVersion{core: core})
+	_ = old.core.Sync()
+	s.files.closeUnused()
+}
+
+// rotation is the rotation settings of a log file.
+type rotation struct {
+	maxSize    int
+	maxAge     int
+	maxBackups int
+}
+
+// fileOutputs holds the log files by name, so that each file is written
+// and rotated by a single lumberjack.Logger whatever the number of cores
+// writing to it.
+type fileOutputs struct {
+	mu    sync.Mutex
+	files map[string]*fileOutput
+	// used are the files opened since the last closeUnused.
+	used map[string]bool
+}
+
+func newFileOutputs() *fileOutputs {
+	return &fileOutputs{
+		files: make(map[string]*fileOutput),
+		used:  make(map[string]bool),
+	}
+}
+
+// open returns the file of name, an open file is reused.
+func (f *fileOutputs) open(name string, r rotation) *fileOutput {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	out, ok := f.files[name]
+	if !ok {
+		out = new(fileOutput)
+		f.files[name] = out
+	}
+	out.configure(name, r)
+	f.used[name] = true
+	return out
+}
+
+// closeUnused closes the files which are not opened since the last call.
+func (f *fileOutputs) closeUnused() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for name, out := range f.files {
+		if !f.used[name] {
+			out.close()
+			delete(f.files, name)
+		}
+	}
+	f.used = make(map[string]bool)
+}
+
+// fileOutput is a log file. Its logger is replaced when the rotation
+// settings change, and is nil once the file is closed.
+type fileOutput struct {
+	mu     sync.Mutex
+	name   string
+	r      rotation
+	logger *lumberjack.Logger
+}
+
+func (o *fileOutput) configure(name string, r rotation) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.logger != nil {
+		if o.r == r {
+			return
+		}
+		_ = o.logger.Close()
+	}
+	o.name = name
+	o.r = r
+	o.logger = &lumberjack.Logger{
+		Filename:   name,
+		MaxSize:    r.maxSize,
+		MaxAge:     r.maxAge,
+		MaxBackups: r.maxBackups,
+		LocalTime:  true,
+		Compress:   true,
+	}
+}
+
+// Write writes p to the file. Once the file is closed, p is written by
+// an old core which is not drained, the file is opened only to append it.
+func (o *fileOutput) Write(p []byte) (int, error) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.logger != nil {
+		return o.logger.Write(p)
+	}
+	f, err := os.OpenFile(o.name, os.O_WRONLY|os.O_APPEND|os.O_CREATE, 0644)
+	if err != nil {
+		return 0, err
+	}
+	n, err := f.Write(p)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return n, err
+}
+
+// Sync does nothing, lumberjack does not buffer.
+func (o *fileOutput) Sync() error {
+	return nil
+}
+
+func (o *fileOutput) close() {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	if o.logger != nil {
+		_ = o.logger.Close()
+		o.logger = nil
+	}
+}
+
+// switchCore writes to the current core of a coreSwitch. The fields added
+// by With are kept, so that they are added to a new core after swap.
+type switchCore struct {
+	sw     *coreSwitch
+	fields []zapcore.Field
+	// cache is the current core with fields, it is rebuilt after swap.
+	cache atomic.Pointer[switchCache]
+}
+
+type switchCache struct {
+	version *coreVersion
+	core    zapcore.Core
+}
+
+func (c *switchCore) current() zapcore.Core {
+	v := c.sw.current.Load()
+	if len(c.fields) == 0 {
+		return v.core
+	}
+	if cached := c.cache.Load(); cached != nil && cached.version == v {
+		return cached.core
+	}
+	core := v.core.With(c.fields)
+	c.cache.Store(&switchCache{version: v, core: core})
+	return core
+}
+
+func (c *switchCore) Enabled(lvl zapcore.Level) bool {
+	return c.current().Enabled(lvl)
+}
+
+func (c *switchCore) With(fields []zapcore.Field) zapcore.Core {
+	merged := make([]zapcore.Field, 0, len(c.fields)+len(fields))
+	merged = append(merged, c.fields...)
+	merged = append(merged, fields...)
+	return &switchCore{sw: c.sw, fields: merged}
+}
+
+func (c *switchCore) Check(ent zapcore.Entry, ce *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	return c.current().Check(ent, ce)
+}
+
+func (c *switchCore) Write(ent zapcore.Entry, fields []zapcore.Field) error {
+	return c.current().Write(ent, fields)
+}
+
+func (c *switchCore) Sync() error {
+	return c.current().Sync()
+}
+
+// Reload applies the level, mode, format, outputs and rotation settings of
+// opts to all loggers, the levels set on named loggers are kept.
+func Reload(opts *conf.Options) error {
+	if logger == nil {
+		panic("log is not inited.")
+	}
+
+	reloadMu.Lock()
+	defer reloadMu.Unlock()
+
+	core, zapLevel, err := newCore(opts, cores.files)
+	if err != nil {
+		return err
+	}
+	cores.swap(core)
+	logger.level.setLevel(zapLevel)
+	stackLevel.SetLevel(stackLevelOf(opts))
+	return nil
+}
+
+// WatchConfig reloads the log options whenever the config file changes,
+// see conf.Watch. The errors of reloading are logged.
+func WatchConfig() {
+	conf.Watch(func(o *conf.Options, err error) {
+		if err == nil {
+			err = Reload(o)
+		}
+		if err != nil {
+			Errorf("reload log config failed: %v", err)
+			return
+		}
+		Info("log config reloaded")
+	})
+}
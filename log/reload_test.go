@@ -0,0 +1,206 @@
+package log
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/tianhongw/misc-go/conf"
+	"github.com/tianhongw/misc-go/util/assert"
+	"go.uber.org/zap/zapcore"
+)
+
+// logConfig is the log part of a config file.
+type logConfig struct {
+	mode    string
+	level   string
+	output  string
+	maxSize int
+}
+
+// loadOptions loads the options of a config file with cfg.
+func loadOptions(t *testing.T, cfg logConfig) *conf.Options {
+	if cfg.mode == "" {
+		cfg.mode = "production"
+	}
+	if cfg.level == "" {
+		cfg.level = "info"
+	}
+	if cfg.maxSize == 0 {
+		cfg.maxSize = 10
+	}
+	content := fmt.Sprintf(`
+[common]
+mode = %q
+[log]
+level = %q
+format = "json"
+output = [%q]
+err_output = [%q]
+max_size = %d
+`, cfg.mode, cfg.level, cfg.output, cfg.output, cfg.maxSize)
+
+	path := filepath.Join(t.TempDir(), "app.toml")
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := conf.Init(path, "toml"); err != nil {
+		t.Fatal(err)
+	}
+	return conf.Opts
+}
+
+// readEntries returns the json entries of a log file.
+func readEntries(t *testing.T, path string) []map[string]interface{} {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var entries []map[string]interface{}
+	for _, line := range strings.Split(strings.TrimSpace(string(data)), "\n") {
+		if line == "" {
+			continue
+		}
+		entry := make(map[string]interface{})
+		if err = json.Unmarshal([]byte(line), &entry); err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry)
+	}
+	return entries
+}
+
+// messages returns the messages of entries, the development encoder
+// names the message M.
+func messages(entries []map[string]interface{}) []string {
+	res := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		msg, ok := entry["msg"]
+		if !ok {
+			msg = entry["M"]
+		}
+		res = append(res, fmt.Sprint(msg))
+	}
+	return res
+}
+
+func TestReloadReusesFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.Nil(t, Init(loadOptions(t, logConfig{output: path})))
+	Info("a")
+	out := cores.files.files[path]
+	lj := out.logger
+
+	// The same file is written by the same lumberjack after reload.
+	assert.Nil(t, Reload(loadOptions(t, logConfig{level: "debug", output: path})))
+	Debug("b")
+	assert.Equal(t, true, cores.files.files[path] == out)
+	assert.Equal(t, true, out.logger == lj)
+	assert.Equal(t, zapLevel("debug"), Levels()[0].Level)
+
+	// New rotation settings replace the lumberjack of the file.
+	assert.Nil(t, Reload(loadOptions(t, logConfig{output: path, maxSize: 20})))
+	Info("c")
+	assert.Equal(t, true, cores.files.files[path] == out)
+	assert.Equal(t, false, out.logger == lj)
+	assert.Equal(t, 20, out.logger.MaxSize)
+
+	assert.Equal(t, []string{"a", "b", "c"}, messages(readEntries(t, path)))
+}
+
+func TestReloadClosesDroppedFile(t *testing.T) {
+	dir := t.TempDir()
+	oldPath, newPath := filepath.Join(dir, "old.log"), filepath.Join(dir, "new.log")
+	assert.Nil(t, Init(loadOptions(t, logConfig{output: oldPath})))
+	Info("a")
+	old := cores.files.files[oldPath]
+
+	assert.Nil(t, Reload(loadOptions(t, logConfig{output: newPath})))
+	Info("b")
+	assert.Equal(t, 1, len(cores.files.files))
+	assert.Nil(t, old.logger)
+	// A late write of the old core is appended without reopening the file.
+	_, err := old.Write([]byte(`{"msg": "late"}` + "\n"))
+	assert.Nil(t, err)
+	assert.Nil(t, old.logger)
+
+	assert.Equal(t, []string{"a", "late"}, messages(readEntries(t, oldPath)))
+	assert.Equal(t, []string{"b"}, messages(readEntries(t, newPath)))
+}
+
+func TestReloadMode(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	assert.Nil(t, Init(loadOptions(t, logConfig{output: path})))
+	Warn("prod")
+
+	// Development mode logs the stacktrace of warnings.
+	assert.Nil(t, Reload(loadOptions(t, logConfig{mode: "development", output: path})))
+	Warn("dev")
+
+	entries := readEntries(t, path)
+	assert.Equal(t, []string{"prod", "dev"}, messages(entries))
+	assert.Nil(t, entries[0]["stacktrace"])
+	// The development encoder names the stacktrace S.
+	assert.NotNil(t, entries[1]["S"])
+}
+
+func TestReloadConcurrent(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "a.log"), filepath.Join(dir, "b.log")}
+	opts := []*conf.Options{
+		loadOptions(t, logConfig{output: paths[0]}),
+		loadOptions(t, logConfig{output: paths[1]}),
+		loadOptions(t, logConfig{output: paths[1], maxSize: 20}),
+	}
+	assert.Nil(t, Init(opts[0]))
+
+	var (
+		wg   sync.WaitGroup
+		stop = make(chan struct{})
+	)
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-stop:
+					return
+				default:
+					Info("x")
+				}
+			}
+		}()
+	}
+	for i := 0; i < 100; i++ {
+		assert.Nil(t, Reload(opts[i%len(opts)]))
+	}
+	close(stop)
+	wg.Wait()
+	Info("y")
+
+	// Only the file of the last options is open.
+	fds, err := os.ReadDir("/proc/self/fd")
+	if err != nil {
+		t.Skip("open files are not listed")
+	}
+	open := 0
+	for _, fd := range fds {
+		if target, err := os.Readlink(filepath.Join("/proc/self/fd", fd.Name())); err == nil && strings.HasPrefix(target, dir) {
+			open++
+		}
+	}
+	assert.Equal(t, 1, open)
+}
+
+func zapLevel(text string) zapcore.Level {
+	var lvl zapcore.Level
+	if err := lvl.UnmarshalText([]byte(text)); err != nil {
+		panic(err)
+	}
+	return lvl
+}